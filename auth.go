@@ -1,6 +1,8 @@
 package httpbulb
 
 import (
+	"crypto/subtle"
+	"encoding/base64"
 	"net/http"
 	"strings"
 
@@ -24,14 +26,109 @@ func BearerAuthHandle(w http.ResponseWriter, r *http.Request) {
 	authPrefix := "Bearer "
 	authorization := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authorization, authPrefix) {
-		w.Header().Set("WWW-Authenticate", `Bearer"`)
-		RenderError(w, "", http.StatusUnauthorized)
+		writeBearerChallenge(w, http.StatusUnauthorized, "", "", "")
 		return
 	}
 	token := authorization[len(authPrefix):]
 	RenderResponse(w, http.StatusOK, AuthResponse{Authenticated: true, Token: token})
 }
 
+// Locations of the API key.
+const (
+	APIKeyInHeader = "header"
+	APIKeyInQuery  = "query"
+	APIKeyInCookie = "cookie"
+)
+
+// APIKeyHandle checks the API key from `Config.APIKeys`.
+// The key is looked up in the header `Config.APIKeyHeader`, in the query parameter `Config.APIKeyQuery`
+// or in the cookie `Config.APIKeyCookie`. `in` query parameter (`header`, `query`, `cookie`)
+// restricts the location of the key.
+// It returns 401 if the key is missing and 403 if the key is not valid.
+func APIKeyHandle(w http.ResponseWriter, r *http.Request) {
+	apiKeyHandle(w, r, getConfig(r).APIKeys)
+}
+
+// APIKeyExpectedHandle checks the API key, which is expected to be equal to the `key` path parameter.
+// It accepts the key in the same locations as `APIKeyHandle`.
+func APIKeyExpectedHandle(w http.ResponseWriter, r *http.Request) {
+	apiKeyHandle(w, r, []string{chi.URLParam(r, "key")})
+}
+
+func apiKeyHandle(w http.ResponseWriter, r *http.Request, validKeys []string) {
+	cfg := getConfig(r)
+	in := r.URL.Query().Get("in")
+
+	locations := []string{APIKeyInHeader, APIKeyInQuery, APIKeyInCookie}
+	switch in {
+	case "":
+	case APIKeyInHeader, APIKeyInQuery, APIKeyInCookie:
+		locations = []string{in}
+	default:
+		RenderError(w, "in must be one of: header, query, cookie", http.StatusBadRequest)
+		return
+	}
+
+	var key, name string
+	for _, location := range locations {
+		switch location {
+		case APIKeyInHeader:
+			key, name = r.Header.Get(cfg.APIKeyHeader), cfg.APIKeyHeader
+		case APIKeyInQuery:
+			key, name = r.URL.Query().Get(cfg.APIKeyQuery), cfg.APIKeyQuery
+		case APIKeyInCookie:
+			key, name = getCookie(r, cfg.APIKeyCookie), cfg.APIKeyCookie
+		}
+		if key != "" {
+			in = location
+			break
+		}
+	}
+
+	if key == "" {
+		RenderError(w, "missing API key", http.StatusUnauthorized)
+		return
+	}
+
+	for _, valid := range validKeys {
+		if valid != "" && subtle.ConstantTimeCompare([]byte(key), []byte(valid)) == 1 {
+			RenderResponse(w, http.StatusOK, APIKeyResponse{Authenticated: true, In: in, Name: name})
+			return
+		}
+	}
+	RenderError(w, "invalid API key", http.StatusForbidden)
+}
+
+// ProxyAuthHandle prompts the user for proxy authorization using HTTP Basic Auth
+// (`Proxy-Authorization` header). It returns 407 with `Proxy-Authenticate` header if not authorized.
+func ProxyAuthHandle(w http.ResponseWriter, r *http.Request) {
+	userParam := chi.URLParam(r, "user")
+	passwdParam := chi.URLParam(r, "passwd")
+
+	user, passwd, ok := parseBasicAuth(r.Header.Get("Proxy-Authorization"))
+
+	if !ok || user != userParam || passwd != passwdParam {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="httpbulb"`)
+		RenderError(w, "", http.StatusProxyAuthRequired)
+		return
+	}
+
+	RenderResponse(w, http.StatusOK, AuthResponse{Authenticated: true, User: user})
+}
+
+// parseBasicAuth parses Basic credentials of Authorization or Proxy-Authorization header.
+func parseBasicAuth(header string) (user, passwd string, ok bool) {
+	credentials, err := parseAuthorization(header)
+	if err != nil || !strings.EqualFold(credentials.scheme, "Basic") || credentials.token68 == "" {
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(credentials.token68)
+	if err != nil {
+		return
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
 func basicAuthHandle(w http.ResponseWriter, r *http.Request, errCode int) {
 	userParam := chi.URLParam(r, "user")
 	passwdParam := chi.URLParam(r, "passwd")
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -140,6 +141,9 @@ func (s *AuthSuite) TestBearerAuth() {
 			resp.Body.Close()
 
 			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			if !tt.wantAuth {
+				require.Equal(t, `Bearer realm="httpbulb"`, resp.Header.Get("WWW-Authenticate"))
+			}
 
 			result := &serverResponse{}
 			err = json.Unmarshal(body, result)
@@ -152,6 +156,114 @@ func (s *AuthSuite) TestBearerAuth() {
 
 }
 
+func (s *AuthSuite) TestAPIKey() {
+	testServer := httptest.NewServer(NewRouterWithConfig(Config{
+		APIKeys:      []string{"key-1", "key-2"},
+		APIKeyHeader: "X-Custom-Key",
+	}))
+	defer testServer.Close()
+
+	type testArgs struct {
+		name           string
+		path           string
+		header         http.Header
+		cookie         *http.Cookie
+		wantStatusCode int
+		wantIn         string
+		wantName       string
+	}
+
+	tests := []testArgs{
+		{name: "configured header", path: "/api-key", header: http.Header{"X-Custom-Key": {"key-1"}},
+			wantStatusCode: http.StatusOK, wantIn: "header", wantName: "X-Custom-Key"},
+		{name: "default header is not used", path: "/api-key", header: http.Header{"X-Api-Key": {"key-1"}},
+			wantStatusCode: http.StatusUnauthorized},
+		{name: "query", path: "/api-key?api_key=key-2",
+			wantStatusCode: http.StatusOK, wantIn: "query", wantName: "api_key"},
+		{name: "cookie", path: "/api-key", cookie: &http.Cookie{Name: "api_key", Value: "key-2"},
+			wantStatusCode: http.StatusOK, wantIn: "cookie", wantName: "api_key"},
+		{name: "invalid key", path: "/api-key?api_key=key-3",
+			wantStatusCode: http.StatusForbidden},
+		{name: "missing key", path: "/api-key",
+			wantStatusCode: http.StatusUnauthorized},
+		{name: "key in another location", path: "/api-key?in=header&api_key=key-1",
+			wantStatusCode: http.StatusUnauthorized},
+		{name: "restricted location", path: "/api-key?in=cookie", cookie: &http.Cookie{Name: "api_key", Value: "key-1"},
+			wantStatusCode: http.StatusOK, wantIn: "cookie", wantName: "api_key"},
+		{name: "unknown location", path: "/api-key?in=body",
+			wantStatusCode: http.StatusBadRequest},
+		{name: "expected key", path: "/api-key/secret", header: http.Header{"X-Custom-Key": {"secret"}},
+			wantStatusCode: http.StatusOK, wantIn: "header", wantName: "X-Custom-Key"},
+		{name: "unexpected key", path: "/api-key/secret", header: http.Header{"X-Custom-Key": {"key-1"}},
+			wantStatusCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, testServer.URL+tt.path, nil)
+			require.NoError(t, err)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+			result := &APIKeyResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			require.True(t, result.Authenticated)
+			require.Equal(t, tt.wantIn, result.In)
+			require.Equal(t, tt.wantName, result.Name)
+		})
+	}
+}
+
+func (s *AuthSuite) TestProxyAuth() {
+	type testArgs struct {
+		name           string
+		proxyUser      *url.Userinfo
+		wantStatusCode int
+	}
+
+	tests := []testArgs{
+		{name: "valid credentials", proxyUser: url.UserPassword("user", "passwd"), wantStatusCode: http.StatusOK},
+		{name: "wrong password", proxyUser: url.UserPassword("user", "wrong"), wantStatusCode: http.StatusProxyAuthRequired},
+		{name: "no credentials", wantStatusCode: http.StatusProxyAuthRequired},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			proxyURL, err := url.Parse(s.testServer.URL)
+			require.NoError(t, err)
+			proxyURL.User = tt.proxyUser
+
+			// the server is used as a proxy, so the transport sends Proxy-Authorization header
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+			resp, err := client.Get("http://bulb.invalid/proxy-auth/user/passwd")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			if tt.wantStatusCode == http.StatusProxyAuthRequired {
+				require.Equal(t, `Basic realm="httpbulb"`, resp.Header.Get("Proxy-Authenticate"))
+				return
+			}
+			result := &AuthResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			require.True(t, result.Authenticated)
+			require.Equal(t, "user", result.User)
+		})
+	}
+}
+
 func TestAuthSuite(t *testing.T) {
 	suite.Run(t, new(AuthSuite))
 }
@@ -8,15 +8,39 @@ import (
 	"crypto/sha512"
 	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
 )
 
+const (
+	digestRealm = "httpbulb"
+	// digestMaxBodySize is the maximum size of the body hashed for `auth-int`
+	digestMaxBodySize = 10 << 20
+)
+
+// digestAlgorithms are the supported algorithms, each of them has a `-sess` variant.
+var digestAlgorithms = []string{"MD5", "SHA-256", "SHA-512-256", "SHA-512"}
+
+// digestDefaultAlgorithms are offered in separate challenges if the algorithm is not given in the path,
+// ordered by preference: a client should choose the strongest one it supports.
+var digestDefaultAlgorithms = []string{"SHA-512-256", "SHA-256", "MD5"}
+
+// digestChallenge describes the challenges offered by the server, one challenge per algorithm.
+type digestChallenge struct {
+	realm      string
+	qop        []string
+	algorithms []string
+}
+
 type digestCredentials struct {
 	username  string
 	realm     string
@@ -27,6 +51,9 @@ type digestCredentials struct {
 	nc        string
 	cnonce    string
 	algorithm string
+	opaque    string
+	// userhash is true if username is hashed (RFC 7616, section 3.4.4)
+	userhash bool
 }
 
 func (d *digestCredentials) fromMap(m map[string]string) *digestCredentials {
@@ -51,13 +78,25 @@ func (d *digestCredentials) fromMap(m map[string]string) *digestCredentials {
 			d.cnonce = v
 		case "algorithm":
 			d.algorithm = v
+		case "opaque":
+			d.opaque = v
+		case "userhash":
+			d.userhash = strings.EqualFold(v, "true")
 		}
 	}
 	return d
 
 }
 
-// DigestAuthHandle prompts the user for authorization using HTTP Digest Auth.
+// DigestAuthHandle prompts the user for authorization using HTTP Digest Auth (RFC 7616).
+// It supports `auth` and `auth-int` qop, MD5, SHA-256, SHA-512-256 (and SHA-512) algorithms
+// with their `-sess` variants, hashed usernames (`userhash=true`) and UTF-8 usernames (`username*`).
+// If the algorithm is not given in the path, the server offers several challenges:
+// SHA-512-256, SHA-256 and MD5.
+//
+// In the strict mode (`Config.DigestStrict` or `strict=true` query parameter) nonces are tracked on the server
+// (`Config.DigestNonces`): the nonce must be issued by the server and not expired, opaque must match
+// and nonce count must increase with every request. An expired nonce with a valid response gets `stale=true`.
 func DigestAuthHandle(w http.ResponseWriter, r *http.Request) {
 	user := chi.URLParam(r, "user")
 	passwd := chi.URLParam(r, "passwd")
@@ -76,14 +115,35 @@ func DigestAuthHandle(w http.ResponseWriter, r *http.Request) {
 		requireCookie = true
 	}
 
-	// Actually `algorithm` path parameter is not relevant,
-	// because algorithm will be taken from Authorization header.
-	// It will be relevant only if the Authorization header is not set or is not Digest.
+	cfg := getConfig(r)
+	strict := cfg.DigestStrict
 
-	switch algorithm {
-	case "MD5", "SHA-256", "SHA-512":
-	default:
-		algorithm = "MD5"
+	switch strings.ToLower(r.URL.Query().Get("strict")) {
+	case "true", "1", "t":
+		strict = true
+	}
+
+	// nonces are tracked only in the strict mode
+	var nonces *DigestNonceStore
+	if strict {
+		nonces = cfg.DigestNonces
+	}
+
+	challenge := digestChallenge{realm: digestRealm, algorithms: digestDefaultAlgorithms}
+
+	// if the algorithm is not given in the path, several challenges are offered,
+	// otherwise the client must use the given algorithm.
+	if algorithm = normalizeDigestAlgorithm(algorithm); algorithm != "" {
+		challenge.algorithms = []string{algorithm}
+	}
+
+	for _, value := range strings.Split(qop, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			challenge.qop = append(challenge.qop, value)
+		}
+	}
+	if len(challenge.qop) == 0 {
+		challenge.qop = []string{"auth"}
 	}
 
 	if staleAfter == "" {
@@ -96,11 +156,16 @@ func DigestAuthHandle(w http.ResponseWriter, r *http.Request) {
 
 	credentials, err := parseDigestAuth(authorization)
 
+	if errors.Is(err, errAuthSyntax) {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if err != nil || (requireCookie && !hasCookie) {
 		// 401 response
 		setCookie(w, "stale_after", staleAfter, secureCookie)
 		setCookie(w, "fake", "fake_value", secureCookie)
-		writeDigestChallengeResponse(w, r, "httpbulb", qop, algorithm, false)
+		writeDigestChallengeResponse(w, r, challenge, false, nonces)
 		return
 	}
 
@@ -111,6 +176,29 @@ func DigestAuthHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	authorized, err := checkDigestAuth(r, credentials, challenge, user, passwd)
+	var bodyErr *bodyError
+	if errors.As(err, &bodyErr) {
+		RenderError(w, bodyErr.msg, bodyErr.status)
+		return
+	}
+
+	if nonces != nil {
+		stale := false
+		if authorized {
+			err = nonces.check(credentials.nonce, credentials.opaque, credentials.nc)
+			if err == nil {
+				setCookie(w, "fake", "fake_value", secureCookie)
+				RenderResponse(w, http.StatusOK, AuthResponse{Authenticated: true, User: user})
+				return
+			}
+			stale = errors.Is(err, errNonceStale)
+		}
+		setCookie(w, "fake", "fake_value", secureCookie)
+		writeDigestChallengeResponse(w, r, challenge, stale, nonces)
+		return
+	}
+
 	currentNonce := credentials.nonce
 
 	staleAfterValue := getCookie(r, "stale_after")
@@ -121,16 +209,16 @@ func DigestAuthHandle(w http.ResponseWriter, r *http.Request) {
 		setCookie(w, "stale_after", staleAfter, secureCookie)
 		setCookie(w, "fake", "fake_value", secureCookie)
 		setCookie(w, "last_nonce", currentNonce, secureCookie)
-		writeDigestChallengeResponse(w, r, "httpbulb", qop, algorithm, true)
+		writeDigestChallengeResponse(w, r, challenge, true, nonces)
 		return
 	}
 
-	if !checkDigestAuth(r, credentials, user, passwd) {
+	if !authorized {
 
 		setCookie(w, "stale_after", staleAfter, secureCookie)
 		setCookie(w, "fake", "fake_value", secureCookie)
 		setCookie(w, "last_nonce", currentNonce, secureCookie)
-		writeDigestChallengeResponse(w, r, "httpbulb", qop, algorithm, false)
+		writeDigestChallengeResponse(w, r, challenge, false, nonces)
 		return
 	}
 
@@ -148,16 +236,34 @@ func parseDigestAuth(authHeader string) (dig *digestCredentials, err error) {
 		err = fmt.Errorf("missing Authorization header")
 		return
 	}
-	parts := strings.SplitN(authHeader, " ", 2)
-	authType := parts[0]
-	authInfo := parts[1]
 
-	if strings.ToLower(authType) != "digest" {
+	credentials, err := parseAuthorization(authHeader)
+	if err != nil {
+		return
+	}
+
+	if !strings.EqualFold(credentials.scheme, "digest") {
 		err = fmt.Errorf("supported authorization type is Digest")
 		return
 	}
 
-	cm := parseHeaderValues(authInfo)
+	if credentials.token68 != "" {
+		err = fmt.Errorf("%w: Digest credentials must be auth-params", errAuthSyntax)
+		return
+	}
+
+	cm := credentials.params
+
+	if extUsername, ok := cm["username*"]; ok {
+		if _, ok := cm["username"]; ok {
+			err = fmt.Errorf("%w: both username and username* are given", errAuthSyntax)
+			return
+		}
+		if cm["username"], err = decodeExtValue(extUsername); err != nil {
+			return
+		}
+	}
+
 	requiredCredentials := []string{"username", "realm", "nonce", "uri", "response"}
 
 	for _, cred := range requiredCredentials {
@@ -171,30 +277,44 @@ func parseDigestAuth(authHeader string) (dig *digestCredentials, err error) {
 
 	if dig.qop != "" {
 		if dig.nc == "" || dig.cnonce == "" {
-			err = fmt.Errorf("missing required credentials 'nc' and 'cnonce'")
-			return
+			return nil, fmt.Errorf("missing required credentials 'nc' and 'cnonce'")
 		}
 	}
 
 	return
 }
 
-func parseHeaderValues(value string) map[string]string {
-
-	parts := strings.Split(value, ",")
-	m := make(map[string]string)
+// decodeExtValue decodes an ext-value (RFC 8187), only UTF-8 charset is supported.
+func decodeExtValue(value string) (string, error) {
+	parts := strings.SplitN(value, "'", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[0], "UTF-8") {
+		return "", fmt.Errorf("%w: ext-value must be in UTF-8''value form", errAuthSyntax)
+	}
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil || !utf8.ValidString(decoded) {
+		return "", fmt.Errorf("%w: ext-value is not a valid UTF-8 percent-encoded string", errAuthSyntax)
+	}
+	return decoded, nil
+}
 
-	for _, part := range parts {
-		part := strings.TrimSpace(part)
-		p := strings.SplitN(part, "=", 2)
-		key := p[0]
-		value := strings.Trim(p[1], `"`)
-		m[key] = value
+// normalizeDigestAlgorithm returns the canonical algorithm name or an empty string if it is not supported.
+func normalizeDigestAlgorithm(algorithm string) string {
+	base, sess := strings.CutSuffix(strings.ToUpper(algorithm), "-SESS")
+	for _, alg := range digestAlgorithms {
+		if alg == base {
+			if sess {
+				return alg + "-sess"
+			}
+			return alg
+		}
 	}
-	return m
+	return ""
 }
 
-func writeDigestChallengeResponse(w http.ResponseWriter, r *http.Request, realm, qop, algorithm string, stale bool) {
+// writeDigestChallengeResponse writes challenges with a new nonce, one challenge per algorithm.
+// If nonces is not nil, the nonce is stored there.
+func writeDigestChallengeResponse(w http.ResponseWriter, r *http.Request, challenge digestChallenge, stale bool,
+	nonces *DigestNonceStore) {
 	ts := time.Now().Unix()
 
 	b := make([]byte, 10)
@@ -210,17 +330,20 @@ func writeDigestChallengeResponse(w http.ResponseWriter, r *http.Request, realm,
 	nonceBuf.WriteString(":")
 	nonceBuf.Write(b)
 
-	nonce := hexDigest(nonceBuf.Bytes(), algorithm)
-	opaque := hexDigest(opaqueB, algorithm)
+	nonce := hexDigest(nonceBuf.Bytes(), "SHA-256")
+	opaque := hexDigest(opaqueB, "SHA-256")
 
-	if qop == "" {
-		qop = "auth"
+	if nonces != nil {
+		nonces.add(nonce, opaque)
 	}
 
-	value := fmt.Sprintf(
-		"Digest qop=%s, realm=%s, algorithm=%s, nonce=%s, opaque=%s stale=%t",
-		qop, realm, algorithm, nonce, opaque, stale)
-	w.Header().Set("WWW-Authenticate", value)
+	for _, algorithm := range challenge.algorithms {
+		value := fmt.Sprintf(
+			"Digest realm=%s, qop=%s, algorithm=%s, nonce=%s, opaque=%s, charset=UTF-8, userhash=true, stale=%t",
+			quoteAuthParam(challenge.realm), quoteAuthParam(strings.Join(challenge.qop, ", ")), algorithm,
+			quoteAuthParam(nonce), quoteAuthParam(opaque), stale)
+		w.Header().Add("WWW-Authenticate", value)
+	}
 	w.WriteHeader(http.StatusUnauthorized)
 
 }
@@ -228,10 +351,13 @@ func writeDigestChallengeResponse(w http.ResponseWriter, r *http.Request, realm,
 func hexDigest(data []byte, algorithm string) string {
 	var h []byte
 
-	switch algorithm {
+	switch strings.TrimSuffix(algorithm, "-sess") {
 	case "SHA-256":
 		checksumB := sha256.Sum256(data)
 		h = checksumB[:]
+	case "SHA-512-256":
+		checksumB := sha512.Sum512_256(data)
+		h = checksumB[:]
 	case "SHA-512":
 		checksumB := sha512.Sum512(data)
 		h = checksumB[:]
@@ -243,20 +369,31 @@ func hexDigest(data []byte, algorithm string) string {
 	return hex.EncodeToString(h)
 }
 
-func ha1(realm, username, password, algorithm string) string {
-	a1 := []byte(fmt.Sprintf("%s:%s:%s", username, realm, password))
-	return hexDigest(a1, algorithm)
+// ha1 returns the hash of A1, for `-sess` algorithms it includes nonce and cnonce.
+func ha1(dig *digestCredentials, username, password string) string {
+	a1 := []byte(fmt.Sprintf("%s:%s:%s", username, dig.realm, password))
+	h := hexDigest(a1, dig.algorithm)
+	if strings.HasSuffix(dig.algorithm, "-sess") {
+		h = hexDigest([]byte(fmt.Sprintf("%s:%s:%s", h, dig.nonce, dig.cnonce)), dig.algorithm)
+	}
+	return h
 }
 
-func ha2(method, uri, algorithm string) string {
-	a2 := []byte(fmt.Sprintf("%s:%s", method, uri))
-	return hexDigest(a2, algorithm)
+// ha2 returns the hash of A2, for `auth-int` it includes the hash of the body.
+func ha2(dig *digestCredentials, method, uri string, body []byte) string {
+	a2 := fmt.Sprintf("%s:%s", method, uri)
+	if dig.qop == "auth-int" {
+		a2 += ":" + hexDigest(body, dig.algorithm)
+	}
+	return hexDigest([]byte(a2), dig.algorithm)
 }
 
-func compileDigestResponse(dig *digestCredentials, password, method, uri string) string {
+// compileDigestResponse computes the expected `response` value for the credentials.
+// username is the real (not hashed) username.
+func compileDigestResponse(dig *digestCredentials, username, password, method, uri string, body []byte) string {
 
-	ha1Value := ha1(dig.realm, dig.username, password, dig.algorithm)
-	ha2Value := ha2(method, uri, dig.algorithm)
+	ha1Value := ha1(dig, username, password)
+	ha2Value := ha2(dig, method, uri, body)
 
 	var resp string
 	switch dig.qop {
@@ -270,16 +407,47 @@ func compileDigestResponse(dig *digestCredentials, password, method, uri string)
 	return hexDigest([]byte(resp), dig.algorithm)
 }
 
-func checkDigestAuth(r *http.Request, dig *digestCredentials, username, password string) (ok bool) {
+func checkDigestAuth(r *http.Request, dig *digestCredentials, challenge digestChallenge, username, password string) (ok bool, err error) {
 
 	if dig == nil {
 		return
 	}
-	if dig.username != username {
+
+	if dig.realm != challenge.realm {
+		return
+	}
+
+	// algorithm defaults to MD5, it must be one of the offered
+	algorithm := "MD5"
+	if dig.algorithm != "" {
+		algorithm = normalizeDigestAlgorithm(dig.algorithm)
+	}
+	if !slices.Contains(challenge.algorithms, algorithm) {
+		return
+	}
+	dig.algorithm = algorithm
+
+	// qop may be omitted only for the RFC 2069 compatibility
+	if dig.qop != "" && !slices.Contains(challenge.qop, dig.qop) {
 		return
 	}
 
-	responseHexDigest := compileDigestResponse(dig, password, r.Method, r.RequestURI)
+	expectedUsername := username
+	if dig.userhash {
+		expectedUsername = hexDigest([]byte(username+":"+dig.realm), algorithm)
+	}
+	if dig.username != expectedUsername {
+		return
+	}
+
+	var body []byte
+	if dig.qop == "auth-int" {
+		if body, err = readBodyLimit(r.Body, digestMaxBodySize); err != nil {
+			return
+		}
+	}
+
+	responseHexDigest := compileDigestResponse(dig, username, password, r.Method, r.RequestURI, body)
 	expectedHexDigest := dig.response
 	if subtle.ConstantTimeCompare([]byte(responseHexDigest), []byte(expectedHexDigest)) == 1 {
 		ok = true
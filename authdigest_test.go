@@ -6,8 +6,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -56,6 +58,12 @@ func (s *AuthDigestSuite) TestDigestAuth() {
 			algorithm: "SHA-256", qop: "auth", wantAuth: true, wantStatusCode: http.StatusOK},
 		{name: "valid SHA-512 digest",
 			algorithm: "SHA-512", qop: "auth", wantAuth: true, wantStatusCode: http.StatusOK},
+		{name: "valid SHA-512-256 digest",
+			algorithm: "SHA-512-256", qop: "auth", wantAuth: true, wantStatusCode: http.StatusOK},
+		{name: "valid MD5-sess digest",
+			algorithm: "MD5-sess", qop: "auth", wantAuth: true, wantStatusCode: http.StatusOK},
+		{name: "valid SHA-256-sess digest",
+			algorithm: "SHA-256-sess", qop: "auth", wantAuth: true, wantStatusCode: http.StatusOK},
 
 		{name: "missing nc",
 			algorithm: "MD5", qop: "auth", wantStatusCode: http.StatusUnauthorized, skippingKeys: []string{"nc"}},
@@ -87,7 +95,7 @@ func (s *AuthDigestSuite) TestDigestAuth() {
 
 			dig := (&digestCredentials{}).fromMap(credentials)
 
-			digestResp := compileDigestResponse(dig, password, http.MethodGet, uri)
+			digestResp := compileDigestResponse(dig, username, password, http.MethodGet, uri, nil)
 
 			credentials["response"] = digestResp
 
@@ -132,6 +140,397 @@ func (s *AuthDigestSuite) TestDigestAuth() {
 
 }
 
+func (s *AuthDigestSuite) TestMalformedAuthorization() {
+	type testArgs struct {
+		name           string
+		authorization  string
+		wantStatusCode int
+	}
+
+	tests := []testArgs{
+		{name: "scheme only", authorization: "Digest", wantStatusCode: http.StatusUnauthorized},
+		{name: "other scheme", authorization: "Basic dXNlcjpwYXNzd2Q=", wantStatusCode: http.StatusUnauthorized},
+		{name: "token68", authorization: "Digest dXNlcjpwYXNzd2Q=", wantStatusCode: http.StatusBadRequest},
+		{name: "unterminated quoted string", authorization: `Digest username="user`, wantStatusCode: http.StatusBadRequest},
+		{name: "missing value", authorization: `Digest username=, realm="httpbulb"`, wantStatusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", s.testServer.URL+"/digest-auth/auth/user/passwd/MD5", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", tt.authorization)
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+		})
+	}
+}
+
+// fetchDigestChallenge requests the challenge and returns the params of the first one.
+func fetchDigestChallenge(t *testing.T, client *http.Client, req *http.Request) map[string]string {
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	challenge, err := parseAuthorization(resp.Header.Get("WWW-Authenticate"))
+	require.NoError(t, err)
+	return challenge.params
+}
+
+func digestAuthorization(uri, username, password, nonce, opaque, nc string) string {
+	credentials := map[string]string{
+		"username":  username,
+		"realm":     "httpbulb",
+		"qop":       "auth",
+		"uri":       uri,
+		"nonce":     nonce,
+		"opaque":    opaque,
+		"nc":        nc,
+		"cnonce":    "0a4f113b",
+		"algorithm": "MD5",
+	}
+	dig := (&digestCredentials{}).fromMap(credentials)
+	credentials["response"] = compileDigestResponse(dig, username, password, http.MethodGet, uri, nil)
+
+	params := make([]string, 0, len(credentials))
+	for k, v := range credentials {
+		params = append(params, k+"="+quoteAuthParam(v))
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+func (s *AuthDigestSuite) TestStrictNonces() {
+	uri := "/digest-auth/auth/user/passwd/MD5?strict=true"
+	addr := s.testServer.URL + uri
+
+	newRequest := func(authorization string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, addr, nil)
+		s.Require().NoError(err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return req
+	}
+
+	challenge := fetchDigestChallenge(s.T(), s.client, newRequest(""))
+	nonce, opaque := challenge["nonce"], challenge["opaque"]
+	s.Require().NotEmpty(nonce)
+
+	type testArgs struct {
+		name           string
+		authorization  string
+		wantStatusCode int
+	}
+
+	// the cases depend on each other: nonce count must increase
+	tests := []testArgs{
+		{
+			name:           "first request",
+			authorization:  digestAuthorization(uri, "user", "passwd", nonce, opaque, "00000001"),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "replayed nonce count",
+			authorization:  digestAuthorization(uri, "user", "passwd", nonce, opaque, "00000001"),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "next nonce count",
+			authorization:  digestAuthorization(uri, "user", "passwd", nonce, opaque, "00000002"),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "wrong password does not consume nonce count",
+			authorization:  digestAuthorization(uri, "user", "wrong", nonce, opaque, "00000003"),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "skipped nonce count",
+			authorization:  digestAuthorization(uri, "user", "passwd", nonce, opaque, "00000003"),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "wrong opaque",
+			authorization:  digestAuthorization(uri, "user", "passwd", nonce, "wrong", "00000004"),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown nonce",
+			authorization:  digestAuthorization(uri, "user", "passwd", "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque, "00000001"),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			resp, err := s.client.Do(newRequest(tt.authorization))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			if tt.wantStatusCode == http.StatusUnauthorized {
+				require.Contains(t, resp.Header.Get("WWW-Authenticate"), "stale=false")
+			}
+		})
+	}
+}
+
+func TestDigestStaleNonce(t *testing.T) {
+	testServer := httptest.NewServer(NewRouterWithConfig(Config{
+		DigestStrict: true,
+		DigestNonces: NewDigestNonceStore(100 * time.Millisecond),
+	}))
+	defer testServer.Close()
+
+	uri := "/digest-auth/auth/user/passwd/MD5"
+	req, err := http.NewRequest(http.MethodGet, testServer.URL+uri, nil)
+	require.NoError(t, err)
+
+	challenge := fetchDigestChallenge(t, http.DefaultClient, req)
+	time.Sleep(150 * time.Millisecond)
+
+	req.Header.Set("Authorization", digestAuthorization(uri, "user", "passwd", challenge["nonce"], challenge["opaque"], "00000001"))
+	challenge = fetchDigestChallenge(t, http.DefaultClient, req)
+	require.Equal(t, "true", challenge["stale"])
+
+	// the new nonce is accepted
+	req.Header.Set("Authorization", digestAuthorization(uri, "user", "passwd", challenge["nonce"], challenge["opaque"], "00000001"))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDigestNonceStore(t *testing.T) {
+	store := &DigestNonceStore{}
+	store.add("nonce", "opaque")
+	require.NoError(t, store.check("nonce", "opaque", "00000001"))
+	require.ErrorIs(t, store.check("nonce", "opaque", "00000001"), errNonceCount)
+
+	// the oldest nonces are dropped when the store is full
+	for i := 0; i < maxDigestNonces; i++ {
+		store.add(fmt.Sprintf("nonce-%d", i), "opaque")
+	}
+	require.Len(t, store.nonces, maxDigestNonces)
+	require.ErrorIs(t, store.check("nonce", "opaque", "00000002"), errNonceUnknown)
+	require.NoError(t, store.check(fmt.Sprintf("nonce-%d", maxDigestNonces-1), "opaque", ""))
+
+	// expired nonces are dropped after another ttl
+	store = NewDigestNonceStore(10 * time.Millisecond)
+	store.add("old", "opaque")
+	time.Sleep(25 * time.Millisecond)
+	store.add("new", "opaque")
+	require.Len(t, store.nonces, 1)
+	require.ErrorIs(t, store.check("old", "opaque", ""), errNonceUnknown)
+}
+
+func (s *AuthDigestSuite) TestMultipleChallenges() {
+	resp, err := s.client.Get(s.testServer.URL + "/digest-auth/auth,auth-int/user/passwd")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	headers := resp.Header.Values("WWW-Authenticate")
+	s.Require().Len(headers, 3)
+
+	var algorithms []string
+	for _, header := range headers {
+		challenge, err := parseAuthorization(header)
+		s.Require().NoError(err)
+		s.Require().Equal("Digest", challenge.scheme)
+		s.Require().Equal("httpbulb", challenge.params["realm"])
+		s.Require().Equal("auth, auth-int", challenge.params["qop"])
+		s.Require().Equal("UTF-8", challenge.params["charset"])
+		s.Require().Equal("true", challenge.params["userhash"])
+		s.Require().Equal("false", challenge.params["stale"])
+		algorithms = append(algorithms, challenge.params["algorithm"])
+	}
+	// the strongest algorithm is offered first
+	s.Require().Equal([]string{"SHA-512-256", "SHA-256", "MD5"}, algorithms)
+
+	resp, err = s.client.Get(s.testServer.URL + "/digest-auth/auth/user/passwd/SHA-256-sess")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Len(resp.Header.Values("WWW-Authenticate"), 1)
+	s.Require().Contains(resp.Header.Get("WWW-Authenticate"), "algorithm=SHA-256-sess")
+}
+
+func (s *AuthDigestSuite) TestRFC7616Credentials() {
+	type testArgs struct {
+		name           string
+		path           string
+		method         string
+		body           string
+		credentials    map[string]string
+		hashBody       string
+		wantStatusCode int
+	}
+
+	username, password := "Jäsøn Doe", "Secret"
+	pathUser := url.PathEscape(username)
+	pathPasswd := url.PathEscape(password)
+
+	tests := []testArgs{
+		{
+			name:           "auth-int with body",
+			path:           "/digest-auth/auth-int/%s/%s/SHA-256",
+			method:         http.MethodPost,
+			body:           `{"hello":"world"}`,
+			credentials:    map[string]string{"qop": "auth-int", "algorithm": "SHA-256", "username*": "UTF-8''" + pathUser},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "auth-int with modified body",
+			path:           "/digest-auth/auth-int/%s/%s/SHA-256",
+			method:         http.MethodPost,
+			body:           `{"hello":"world"}`,
+			hashBody:       `{"hello":"moon"}`,
+			credentials:    map[string]string{"qop": "auth-int", "algorithm": "SHA-256", "username*": "UTF-8''" + pathUser},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "auth-int with too large body",
+			path:           "/digest-auth/auth-int/%s/%s/SHA-256",
+			method:         http.MethodPost,
+			body:           strings.Repeat("a", digestMaxBodySize+1),
+			credentials:    map[string]string{"qop": "auth-int", "algorithm": "SHA-256", "username*": "UTF-8''" + pathUser},
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "qop is not offered",
+			path:           "/digest-auth/auth/%s/%s/SHA-256",
+			method:         http.MethodGet,
+			credentials:    map[string]string{"qop": "auth-int", "algorithm": "SHA-256", "username*": "UTF-8''" + pathUser},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "hashed username",
+			path:   "/digest-auth/auth/%s/%s",
+			method: http.MethodGet,
+			credentials: map[string]string{
+				"qop": "auth", "algorithm": "SHA-512-256", "userhash": "true",
+				"username": hexDigest([]byte(username+":httpbulb"), "SHA-512-256"),
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:   "hashed username with wrong algorithm",
+			path:   "/digest-auth/auth/%s/%s",
+			method: http.MethodGet,
+			credentials: map[string]string{
+				"qop": "auth", "algorithm": "SHA-512-256", "userhash": "true",
+				"username": hexDigest([]byte(username+":httpbulb"), "MD5"),
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "algorithm is not offered",
+			path:           "/digest-auth/auth/%s/%s",
+			method:         http.MethodGet,
+			credentials:    map[string]string{"qop": "auth", "algorithm": "SHA-512", "username*": "UTF-8''" + pathUser},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "both username and username*",
+			path:           "/digest-auth/auth/%s/%s",
+			method:         http.MethodGet,
+			credentials:    map[string]string{"qop": "auth", "username": username, "username*": "UTF-8''" + pathUser},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid username*",
+			path:           "/digest-auth/auth/%s/%s",
+			method:         http.MethodGet,
+			credentials:    map[string]string{"qop": "auth", "username*": "ISO-8859-1''J%E4s%F8n"},
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			uri := fmt.Sprintf(tt.path, pathUser, pathPasswd)
+			credentials := map[string]string{
+				"realm":  "httpbulb",
+				"uri":    uri,
+				"nonce":  "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+				"nc":     "00000001",
+				"cnonce": "0a4f113b",
+			}
+			for k, v := range tt.credentials {
+				credentials[k] = v
+			}
+
+			hashBody := tt.hashBody
+			if hashBody == "" {
+				hashBody = tt.body
+			}
+			dig := (&digestCredentials{}).fromMap(credentials)
+			credentials["response"] = compileDigestResponse(dig, username, password, tt.method, uri, []byte(hashBody))
+
+			params := make([]string, 0, len(credentials))
+			for k, v := range credentials {
+				if k == "username*" {
+					// ext-value is not a quoted-string
+					params = append(params, k+"="+v)
+					continue
+				}
+				params = append(params, k+"="+quoteAuthParam(v))
+			}
+
+			req, err := http.NewRequest(tt.method, s.testServer.URL+uri, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Digest "+strings.Join(params, ", "))
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+		})
+	}
+}
+
 func TestAuthDigestSuite(t *testing.T) {
 	suite.Run(t, new(AuthDigestSuite))
 }
+
+func FuzzParseDigestAuth(f *testing.F) {
+	f.Add(`Digest username="mememe", realm="httpbulb", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", ` +
+		`uri="/digest-auth/auth/mememe/mymymy", qop=auth, nc=00000001, cnonce="0a4f113b", ` +
+		`response="6629fae49393a05397450978507c4ef1", algorithm=MD5`)
+	f.Add(`Digest username="a\"b", realm="x,y", nonce=n, uri="/", response=r`)
+	f.Add("Digest")
+	f.Add("Digest ")
+	f.Add(`Digest realm="`)
+	f.Add("Bearer abc==")
+
+	f.Fuzz(func(t *testing.T, header string) {
+		dig, err := parseDigestAuth(header)
+		if err != nil {
+			require.Nil(t, dig)
+			return
+		}
+		require.NotNil(t, dig)
+
+		// serialized credentials must be parsed back to the same values
+		values := map[string]string{
+			"username": dig.username, "realm": dig.realm, "nonce": dig.nonce,
+			"uri": dig.uri, "response": dig.response, "qop": dig.qop,
+			"nc": dig.nc, "cnonce": dig.cnonce, "algorithm": dig.algorithm,
+			"opaque": dig.opaque,
+		}
+		if dig.userhash {
+			values["userhash"] = "true"
+		}
+		params := make([]string, 0, len(values))
+		for k, v := range values {
+			params = append(params, k+"="+quoteAuthParam(v))
+		}
+
+		parsed, err := parseDigestAuth("Digest " + strings.Join(params, ", "))
+		require.NoError(t, err)
+		require.Equal(t, dig, parsed)
+	})
+}
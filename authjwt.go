@@ -0,0 +1,104 @@
+package httpbulb
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const bearerRealm = "httpbulb"
+
+// BearerJWTHandle validates a JWT bearer token.
+// The signature is verified with the configured HS256 secret (`Config.JWTSecret`)
+// or with RS256/ES256 keys (`Config.JWTKeys` and the OAuth provider key), published at `/.well-known/jwks.json`.
+// `exp` and `nbf` claims are always checked.
+//
+// Query parameters:
+//   - `aud` is the expected audience;
+//   - `iss` is the expected issuer;
+//   - `scope` is a space-delimited list of required scopes, it can be repeated.
+//
+// On failure it returns RFC 6750 challenge: 401 with `error="invalid_token"`,
+// 400 with `error="invalid_request"` or 403 with `error="insufficient_scope"`.
+func BearerJWTHandle(w http.ResponseWriter, r *http.Request) {
+	cfg := getConfig(r)
+	query := r.URL.Query()
+
+	authorization := r.Header.Get("Authorization")
+	scheme, token, _ := strings.Cut(authorization, " ")
+
+	if !strings.EqualFold(scheme, "Bearer") {
+		// the request lacks any authentication information: the challenge has no error code.
+		writeBearerChallenge(w, http.StatusUnauthorized, "", "", "")
+		return
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		writeBearerChallenge(w, http.StatusBadRequest, "invalid_request", "missing token", "")
+		return
+	}
+
+	jwt, err := parseJWT(token)
+	if err != nil {
+		writeBearerChallenge(w, http.StatusUnauthorized, "invalid_token", err.Error(), "")
+		return
+	}
+
+	if err = jwt.verifySignature(cfg.JWTSecret, cfg.jwtKeys()); err != nil {
+		writeBearerChallenge(w, http.StatusUnauthorized, "invalid_token", err.Error(), "")
+		return
+	}
+
+	if err = jwt.verifyClaims(time.Now(), query.Get("aud"), query.Get("iss")); err != nil {
+		writeBearerChallenge(w, http.StatusUnauthorized, "invalid_token", err.Error(), "")
+		return
+	}
+
+	var required []string
+	for _, scope := range query["scope"] {
+		required = append(required, strings.Fields(scope)...)
+	}
+
+	if missing := jwt.missingScopes(required); len(missing) > 0 {
+		writeBearerChallenge(w, http.StatusForbidden, "insufficient_scope",
+			"missing scopes: "+strings.Join(missing, " "), strings.Join(required, " "))
+		return
+	}
+
+	RenderResponse(w, http.StatusOK, &JWTResponse{
+		Authenticated: true,
+		Header:        jwt.header,
+		Claims:        jwt.claims,
+	})
+}
+
+// JWKSHandle returns the public keys used to verify JWT signatures:
+// `Config.JWTKeys` and the key of the OAuth provider.
+func JWKSHandle(w http.ResponseWriter, r *http.Request) {
+	resp := &JWKSResponse{Keys: []JWK{}}
+	for _, key := range getConfig(r).jwtKeys() {
+		if jwk, ok := newJWK(key); ok {
+			resp.Keys = append(resp.Keys, jwk)
+		}
+	}
+	RenderResponse(w, http.StatusOK, resp)
+}
+
+// writeBearerChallenge writes `WWW-Authenticate` header as described in RFC 6750 (section 3)
+// and renders the error.
+func writeBearerChallenge(w http.ResponseWriter, code int, errCode, description, scope string) {
+	value := fmt.Sprintf("Bearer realm=%q", bearerRealm)
+	if errCode != "" {
+		value += fmt.Sprintf(", error=%q", errCode)
+	}
+	if description != "" {
+		value += fmt.Sprintf(", error_description=%q", strings.ReplaceAll(description, `"`, "'"))
+	}
+	if scope != "" {
+		value += fmt.Sprintf(", scope=%q", scope)
+	}
+	w.Header().Set("WWW-Authenticate", value)
+	RenderError(w, description, code)
+}
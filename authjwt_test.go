@@ -0,0 +1,224 @@
+package httpbulb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type JWTSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	client     *http.Client
+	secret     []byte
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+}
+
+func (s *JWTSuite) SetupSuite() {
+	var err error
+	s.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	s.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+	s.secret = []byte("bulb-secret")
+
+	cfg := Config{
+		JWTSecret: s.secret,
+		JWTKeys: []JWTKey{
+			{ID: "rsa-key", Key: s.rsaKey},
+			{ID: "ec-key", Key: &s.ecKey.PublicKey},
+		},
+	}
+	s.testServer = httptest.NewServer(NewRouterWithConfig(cfg))
+	s.client = http.DefaultClient
+}
+
+func (s *JWTSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func (s *JWTSuite) TestBearerJWT() {
+	type testArgs struct {
+		name           string
+		authorization  string
+		query          string
+		wantStatusCode int
+		wantChallenge  string
+	}
+
+	now := time.Now().Unix()
+
+	sign := func(key interface{}, kid string, claims map[string]interface{}) string {
+		token, err := SignJWT(key, kid, claims)
+		s.Require().NoError(err)
+		return "Bearer " + token
+	}
+
+	validClaims := map[string]interface{}{
+		"sub":   "user",
+		"iss":   "https://issuer.example",
+		"aud":   []string{"api", "other"},
+		"exp":   now + 60,
+		"nbf":   now - 60,
+		"scope": "read write",
+	}
+
+	wrongKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	noneClaims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user"}`))
+
+	tests := []testArgs{
+		{name: "HS256", authorization: sign(s.secret, "", validClaims), wantStatusCode: http.StatusOK},
+		{name: "RS256", authorization: sign(s.rsaKey, "rsa-key", validClaims), wantStatusCode: http.StatusOK},
+		{name: "ES256 without kid", authorization: sign(s.ecKey, "", validClaims), wantStatusCode: http.StatusOK},
+		{
+			name:           "aud, iss and scopes",
+			authorization:  sign(s.ecKey, "ec-key", validClaims),
+			query:          "aud=api&iss=https://issuer.example&scope=read&scope=write",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "no authorization",
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb"`,
+		},
+		{
+			name:           "empty token",
+			authorization:  "Bearer ",
+			wantStatusCode: http.StatusBadRequest,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_request"`,
+		},
+		{
+			name:           "malformed token",
+			authorization:  "Bearer 1234567890",
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token"`,
+		},
+		{
+			name:           "wrong secret",
+			authorization:  sign([]byte("wrong"), "", validClaims),
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token", error_description="signature is invalid"`,
+		},
+		{
+			name:           "wrong key",
+			authorization:  sign(wrongKey, "ec-key", validClaims),
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token", error_description="signature is invalid"`,
+		},
+		{
+			name:           "unknown kid",
+			authorization:  sign(s.rsaKey, "unknown", validClaims),
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token"`,
+		},
+		{
+			name:           "alg none",
+			authorization:  "Bearer " + noneHeader + "." + noneClaims + ".",
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token"`,
+		},
+		{
+			name:           "expired",
+			authorization:  sign(s.secret, "", map[string]interface{}{"exp": now - 10}),
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token", error_description="token is expired"`,
+		},
+		{
+			name:           "not valid yet",
+			authorization:  sign(s.secret, "", map[string]interface{}{"nbf": now + 60}),
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token", error_description="token is not valid yet"`,
+		},
+		{
+			name:           "wrong audience",
+			authorization:  sign(s.secret, "", validClaims),
+			query:          "aud=unknown",
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token", error_description="aud: expected 'unknown'"`,
+		},
+		{
+			name:           "wrong issuer",
+			authorization:  sign(s.secret, "", validClaims),
+			query:          "iss=unknown",
+			wantStatusCode: http.StatusUnauthorized,
+			wantChallenge:  `Bearer realm="httpbulb", error="invalid_token", error_description="iss: expected 'unknown'"`,
+		},
+		{
+			name:           "insufficient scope",
+			authorization:  sign(s.secret, "", validClaims),
+			query:          "scope=read+admin",
+			wantStatusCode: http.StatusForbidden,
+			wantChallenge: `Bearer realm="httpbulb", error="insufficient_scope", ` +
+				`error_description="missing scopes: admin", scope="read admin"`,
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, s.testServer.URL+"/bearer/jwt?"+tt.query, nil)
+			require.NoError(t, err)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			if tt.wantStatusCode != http.StatusOK {
+				require.True(t, strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), tt.wantChallenge),
+					resp.Header.Get("WWW-Authenticate"))
+				return
+			}
+
+			result := new(JWTResponse)
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			require.True(t, result.Authenticated)
+			require.Equal(t, "user", result.Claims["sub"])
+			require.Equal(t, "JWT", result.Header["typ"])
+		})
+	}
+}
+
+func (s *JWTSuite) TestJWKS() {
+	resp, err := s.client.Get(s.testServer.URL + "/.well-known/jwks.json")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	result := new(JWKSResponse)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	s.Require().Len(result.Keys, 3)
+
+	s.Require().Equal("RSA", result.Keys[0].Kty)
+	s.Require().Equal("rsa-key", result.Keys[0].Kid)
+	s.Require().Equal("RS256", result.Keys[0].Alg)
+	s.Require().Equal("AQAB", result.Keys[0].E)
+
+	s.Require().Equal("EC", result.Keys[1].Kty)
+	s.Require().Equal("P-256", result.Keys[1].Crv)
+	s.Require().Equal("ES256", result.Keys[1].Alg)
+
+	// the OAuth provider key
+	s.Require().Equal("httpbulb-oauth", result.Keys[2].Kid)
+}
+
+func TestJWTSuite(t *testing.T) {
+	suite.Run(t, new(JWTSuite))
+}
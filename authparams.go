@@ -0,0 +1,179 @@
+package httpbulb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errAuthSyntax is returned when the Authorization header is malformed.
+var errAuthSyntax = errors.New("malformed authorization header")
+
+// authCredentials is the parsed value of the Authorization header (RFC 7235, section 2.1):
+// an auth-scheme followed by either a token68 or a comma-separated list of auth-params.
+type authCredentials struct {
+	scheme  string
+	token68 string
+	// params contains auth-params with lower-cased names and unquoted values.
+	params map[string]string
+}
+
+// parseAuthorization parses the Authorization (or Proxy-Authorization) header value.
+func parseAuthorization(header string) (c authCredentials, err error) {
+	header = strings.TrimLeft(header, " \t")
+
+	end := 0
+	for end < len(header) && isTokenChar(header[end]) {
+		end++
+	}
+	if end == 0 {
+		err = fmt.Errorf("%w: missing auth-scheme", errAuthSyntax)
+		return
+	}
+	c.scheme = header[:end]
+
+	rest := header[end:]
+	if rest != "" && rest[0] != ' ' {
+		err = fmt.Errorf("%w: unexpected %q after auth-scheme", errAuthSyntax, rest[0])
+		return
+	}
+	rest = strings.Trim(rest, " \t")
+
+	if isToken68(rest) {
+		c.token68 = rest
+		return
+	}
+
+	c.params, err = parseAuthParams(rest)
+	return
+}
+
+// parseAuthParams parses a comma-separated list of auth-params: `name=token` or `name="quoted string"`.
+// Parameter names are case-insensitive and must occur only once. Empty list elements are ignored.
+func parseAuthParams(s string) (params map[string]string, err error) {
+	params = make(map[string]string)
+	i := 0
+
+	for {
+		// skip optional whitespace and empty list elements
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == ',') {
+			i++
+		}
+		if i == len(s) {
+			return
+		}
+
+		start := i
+		for i < len(s) && isTokenChar(s[i]) {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("%w: expected parameter name at position %d", errAuthSyntax, i)
+		}
+		name := strings.ToLower(s[start:i])
+
+		i = skipWhitespace(s, i)
+		if i == len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("%w: expected '=' after %q", errAuthSyntax, name)
+		}
+		i = skipWhitespace(s, i+1)
+
+		var value string
+		if i < len(s) && s[i] == '"' {
+			if value, i, err = readQuotedString(s, i); err != nil {
+				return nil, err
+			}
+		} else {
+			start = i
+			for i < len(s) && isTokenChar(s[i]) {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("%w: expected value of %q", errAuthSyntax, name)
+			}
+			value = s[start:i]
+		}
+
+		if _, ok := params[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate parameter %q", errAuthSyntax, name)
+		}
+		params[name] = value
+
+		i = skipWhitespace(s, i)
+		if i < len(s) && s[i] != ',' {
+			return nil, fmt.Errorf("%w: expected ',' after %q", errAuthSyntax, name)
+		}
+	}
+}
+
+// readQuotedString reads a quoted-string starting at s[i] == '"', it unescapes quoted-pairs.
+// It returns the value and the position after the closing quote.
+func readQuotedString(s string, i int) (value string, next int, err error) {
+	var b strings.Builder
+	for i++; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", i, fmt.Errorf("%w: unterminated quoted string", errAuthSyntax)
+			}
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", i, fmt.Errorf("%w: unterminated quoted string", errAuthSyntax)
+}
+
+// quoteAuthParam returns the value as a quoted-string, escaping `"` and `\`.
+func quoteAuthParam(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if value[i] == '"' || value[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(value[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func skipWhitespace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// isTokenChar reports whether c is a `tchar` (RFC 9110, section 5.6.2).
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// isToken68 reports whether s is a token68 (RFC 7235, section 2.1).
+func isToken68(s string) bool {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("-._~+/", c) >= 0 {
+			i++
+			continue
+		}
+		break
+	}
+	if i == 0 {
+		return false
+	}
+	for i < len(s) && s[i] == '=' {
+		i++
+	}
+	return i == len(s)
+}
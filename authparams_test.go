@@ -0,0 +1,67 @@
+package httpbulb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthorization(t *testing.T) {
+	type testArgs struct {
+		name        string
+		header      string
+		wantScheme  string
+		wantToken68 string
+		wantParams  map[string]string
+		wantErr     bool
+	}
+
+	tests := []testArgs{
+		{name: "scheme only", header: "Digest", wantScheme: "Digest", wantParams: map[string]string{}},
+		{name: "token68", header: "Bearer abc.DEF-_~+/==", wantScheme: "Bearer", wantToken68: "abc.DEF-_~+/=="},
+		{
+			name:       "tokens and quoted strings",
+			header:     `Digest username="Mufasa", Realm="http-auth@example.org",qop=auth ,  nc = 00000001`,
+			wantScheme: "Digest",
+			wantParams: map[string]string{
+				"username": "Mufasa", "realm": "http-auth@example.org", "qop": "auth", "nc": "00000001",
+			},
+		},
+		{
+			name:       "comma and escapes in quoted string",
+			header:     `Digest uri="/dir/index.html?a=1,b=2", username="J\"o\\e"`,
+			wantScheme: "Digest",
+			wantParams: map[string]string{"uri": "/dir/index.html?a=1,b=2", "username": `J"o\e`},
+		},
+		{
+			name:       "empty list elements",
+			header:     `Digest ,, realm="a",, nonce=b,`,
+			wantScheme: "Digest",
+			wantParams: map[string]string{"realm": "a", "nonce": "b"},
+		},
+		{name: "empty quoted value", header: `Digest realm=""`, wantScheme: "Digest", wantParams: map[string]string{"realm": ""}},
+		{name: "empty", header: "", wantErr: true},
+		{name: "no space after scheme", header: `Digest,realm="a"`, wantErr: true},
+		{name: "missing value", header: `Digest realm=, nonce="a"`, wantErr: true},
+		{name: "invalid token value", header: `Digest realm=a@b`, wantErr: true},
+		{name: "missing equals", header: `Digest realm "a"`, wantErr: true},
+		{name: "unterminated quoted string", header: `Digest realm="a`, wantErr: true},
+		{name: "trailing escape", header: `Digest realm="a\`, wantErr: true},
+		{name: "missing comma", header: `Digest realm="a" nonce="b"`, wantErr: true},
+		{name: "duplicate parameter", header: `Digest realm="a", REALM="b"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAuthorization(tt.header)
+			if tt.wantErr {
+				require.ErrorIs(t, err, errAuthSyntax)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantScheme, got.scheme)
+			require.Equal(t, tt.wantToken68, got.token68)
+			require.Equal(t, tt.wantParams, got.params)
+		})
+	}
+}
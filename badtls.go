@@ -0,0 +1,208 @@
+package httpbulb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Names of the badssl-style TLS listeners.
+const (
+	BadTLSValid           = "valid"
+	BadTLSExpired         = "expired"
+	BadTLSNotYetValid     = "not-yet-valid"
+	BadTLSWrongHost       = "wrong-host"
+	BadTLSUntrustedRoot   = "untrusted-root"
+	BadTLSIncompleteChain = "incomplete-chain"
+	BadTLSVersion10       = "tls-v1-0"
+	BadTLSVersion11       = "tls-v1-1"
+	BadTLSRevoked         = "revoked"
+)
+
+// BadTLSCases are names of the badssl-style listeners in the order they are started.
+var BadTLSCases = []string{
+	BadTLSValid,
+	BadTLSExpired,
+	BadTLSNotYetValid,
+	BadTLSWrongHost,
+	BadTLSUntrustedRoot,
+	BadTLSIncompleteChain,
+	BadTLSVersion10,
+	BadTLSVersion11,
+	BadTLSRevoked,
+}
+
+// BadTLSCRLPath is the path of the certificate revocation list, served by every badssl-style listener.
+const BadTLSCRLPath = "/badssl.crl"
+
+// BadTLSOptions are the options of `StartBadTLSServers`.
+type BadTLSOptions struct {
+	// Host is the listening host. Default is 127.0.0.1.
+	Host string
+	// Port is the port of the first listener, the others use consecutive ports.
+	// If zero, random ports are used.
+	Port int
+	// Hosts are the names included in the certificates. Default is localhost, 127.0.0.1 and Host.
+	Hosts []string
+	// CA issues the certificates. If nil, an ephemeral CA is created.
+	CA *CertAuthority
+}
+
+// BadTLSServers is a set of TLS listeners with broken certificates or configurations,
+// similar to badssl.com. It is intended to test certificate validation in HTTP clients.
+//
+// All certificates (except `untrusted-root`) are issued by `CA`, a client should trust `RootCAs`.
+// `tls-v1-0` and `tls-v1-1` listeners have valid certificates but accept only legacy TLS versions.
+// The `revoked` certificate is valid, but it is listed in the CRL served at `BadTLSCRLPath`,
+// so it is rejected only by clients which check revocation.
+type BadTLSServers struct {
+	// CA is the certificate authority of the listeners.
+	CA *CertAuthority
+	// URLs maps listener names (`BadTLSCases`) to their base URLs.
+	URLs map[string]string
+
+	servers []*http.Server
+}
+
+// StartBadTLSServers starts a badssl-style TLS listener for every case of `BadTLSCases`.
+// Each listener serves the handler.
+func StartBadTLSServers(handler http.Handler, opts BadTLSOptions) (b *BadTLSServers, err error) {
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if len(opts.Hosts) == 0 {
+		opts.Hosts = []string{"localhost", "127.0.0.1"}
+		if ip := net.ParseIP(opts.Host); ip == nil || !ip.IsUnspecified() {
+			opts.Hosts = append(opts.Hosts, opts.Host)
+		}
+	}
+	if opts.CA == nil {
+		if opts.CA, err = NewCertAuthority("httpbulb badssl CA"); err != nil {
+			return
+		}
+	}
+
+	b = &BadTLSServers{CA: opts.CA, URLs: make(map[string]string)}
+
+	urlHost := opts.Host
+	if ip := net.ParseIP(urlHost); ip != nil && ip.IsUnspecified() {
+		urlHost = "localhost"
+	}
+
+	listeners := make([]net.Listener, 0, len(BadTLSCases))
+	for i := range BadTLSCases {
+		port := 0
+		if opts.Port > 0 {
+			port = opts.Port + i
+		}
+		var ln net.Listener
+		if ln, err = net.Listen("tcp", net.JoinHostPort(opts.Host, strconv.Itoa(port))); err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+		_, listenPort, _ := net.SplitHostPort(ln.Addr().String())
+		b.URLs[BadTLSCases[i]] = "https://" + net.JoinHostPort(urlHost, listenPort)
+	}
+
+	crlURL := b.URLs[BadTLSValid] + BadTLSCRLPath
+
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+	mux.HandleFunc(BadTLSCRLPath, func(w http.ResponseWriter, r *http.Request) {
+		crl, err := b.CA.CRL()
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pkix-crl")
+		w.Write(crl)
+	})
+
+	for i, name := range BadTLSCases {
+		var tlsConfig *tls.Config
+		if tlsConfig, err = badTLSConfig(name, opts.CA, opts.Hosts, crlURL); err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		srv := &http.Server{Handler: mux, TLSConfig: tlsConfig, ReadHeaderTimeout: 10 * time.Second}
+		b.servers = append(b.servers, srv)
+		go srv.ServeTLS(listeners[i], "", "")
+	}
+	return
+}
+
+// RootCAs returns the pool with the root certificate of the CA, it doesn't trust the `untrusted-root` listener.
+func (b *BadTLSServers) RootCAs() *x509.CertPool {
+	return b.CA.Pool()
+}
+
+// Close stops all listeners.
+func (b *BadTLSServers) Close() error {
+	var errs []error
+	for _, srv := range b.servers {
+		errs = append(errs, srv.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// badTLSConfig returns the TLS configuration of the listener.
+func badTLSConfig(name string, ca *CertAuthority, hosts []string, crlURL string) (*tls.Config, error) {
+	now := time.Now()
+	certOpts := ServerCertOptions{Hosts: hosts}
+	issuer := ca
+	cfg := &tls.Config{}
+
+	switch name {
+	case BadTLSExpired:
+		certOpts.NotBefore = now.AddDate(0, 0, -30)
+		certOpts.NotAfter = now.AddDate(0, 0, -1)
+	case BadTLSNotYetValid:
+		certOpts.NotBefore = now.AddDate(0, 0, 1)
+		certOpts.NotAfter = now.AddDate(0, 0, 30)
+	case BadTLSWrongHost:
+		certOpts.Hosts = []string{"wrong.host.invalid"}
+	case BadTLSUntrustedRoot:
+		untrusted, err := NewCertAuthority("httpbulb untrusted CA")
+		if err != nil {
+			return nil, err
+		}
+		issuer = untrusted
+	case BadTLSIncompleteChain:
+		intermediate, err := ca.NewIntermediate("httpbulb intermediate CA")
+		if err != nil {
+			return nil, err
+		}
+		issuer = intermediate
+	case BadTLSRevoked:
+		certOpts.CRLDistributionPoints = []string{crlURL}
+	case BadTLSVersion10:
+		cfg.MinVersion, cfg.MaxVersion = tls.VersionTLS10, tls.VersionTLS10
+	case BadTLSVersion11:
+		cfg.MinVersion, cfg.MaxVersion = tls.VersionTLS11, tls.VersionTLS11
+	}
+
+	cert, err := issuer.IssueServerCert(certOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case BadTLSIncompleteChain:
+		// the intermediate certificate is not sent
+		cert.Certificate = cert.Certificate[:1]
+	case BadTLSRevoked:
+		ca.Revoke(cert.Leaf)
+	}
+
+	cfg.Certificates = []tls.Certificate{cert}
+	return cfg, nil
+}
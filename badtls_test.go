@@ -0,0 +1,117 @@
+package httpbulb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type BadTLSSuite struct {
+	suite.Suite
+	servers *BadTLSServers
+}
+
+func (s *BadTLSSuite) SetupSuite() {
+	var err error
+	s.servers, err = StartBadTLSServers(NewRouter(), BadTLSOptions{})
+	s.Require().NoError(err)
+	s.Require().Len(s.servers.URLs, len(BadTLSCases))
+}
+
+func (s *BadTLSSuite) TearDownSuite() {
+	s.Require().NoError(s.servers.Close())
+}
+
+func (s *BadTLSSuite) client(minVersion uint16) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: s.servers.RootCAs(), MinVersion: minVersion},
+	}}
+}
+
+func (s *BadTLSSuite) TestListeners() {
+	type testArgs struct {
+		name       string
+		minVersion uint16
+		checkErr   func(t *testing.T, err error)
+	}
+
+	var (
+		unknownAuthority = func(t *testing.T, err error) {
+			require.ErrorAs(t, err, new(x509.UnknownAuthorityError))
+		}
+		invalidCert = func(reason x509.InvalidReason) func(t *testing.T, err error) {
+			return func(t *testing.T, err error) {
+				var certErr x509.CertificateInvalidError
+				require.ErrorAs(t, err, &certErr)
+				require.Equal(t, reason, certErr.Reason)
+			}
+		}
+		versionErr = func(t *testing.T, err error) {
+			require.ErrorContains(t, err, "protocol version")
+		}
+	)
+
+	tests := []testArgs{
+		{name: BadTLSValid},
+		{name: BadTLSExpired, checkErr: invalidCert(x509.Expired)},
+		{name: BadTLSNotYetValid, checkErr: invalidCert(x509.Expired)},
+		{name: BadTLSWrongHost, checkErr: func(t *testing.T, err error) {
+			require.ErrorAs(t, err, new(x509.HostnameError))
+		}},
+		{name: BadTLSUntrustedRoot, checkErr: unknownAuthority},
+		{name: BadTLSIncompleteChain, checkErr: unknownAuthority},
+		{name: BadTLSVersion10, checkErr: versionErr},
+		{name: BadTLSVersion10, minVersion: tls.VersionTLS10},
+		{name: BadTLSVersion11, checkErr: versionErr},
+		{name: BadTLSVersion11, minVersion: tls.VersionTLS11},
+		// revocation is not checked by crypto/tls
+		{name: BadTLSRevoked},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			resp, err := s.client(tt.minVersion).Get(s.servers.URLs[tt.name] + "/get")
+			if tt.checkErr != nil {
+				require.Error(t, err)
+				tt.checkErr(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func (s *BadTLSSuite) TestRevoked() {
+	client := s.client(0)
+
+	resp, err := client.Get(s.servers.URLs[BadTLSRevoked] + "/get")
+	s.Require().NoError(err)
+	resp.Body.Close()
+
+	leaf := resp.TLS.PeerCertificates[0]
+	s.Require().Len(leaf.CRLDistributionPoints, 1)
+
+	resp, err = client.Get(leaf.CRLDistributionPoints[0])
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal("application/pkix-crl", resp.Header.Get("Content-Type"))
+
+	der, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	crl, err := x509.ParseRevocationList(der)
+	s.Require().NoError(err)
+	s.Require().NoError(crl.CheckSignatureFrom(s.servers.CA.Cert))
+	s.Require().Len(crl.RevokedCertificateEntries, 1)
+	s.Require().Equal(leaf.SerialNumber, crl.RevokedCertificateEntries[0].SerialNumber)
+}
+
+func TestBadTLSSuite(t *testing.T) {
+	suite.Run(t, new(BadTLSSuite))
+}
@@ -0,0 +1,192 @@
+package httpbulb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+// CertAuthority is an ephemeral in-memory certificate authority.
+// It issues ECDSA P-256 certificates and is intended for tests and local setups only.
+type CertAuthority struct {
+	// Cert is the CA certificate.
+	Cert *x509.Certificate
+	// Key is the CA private key.
+	Key *ecdsa.PrivateKey
+	// chain contains the issuers of the CA certificate up to the root, it is empty for the root CA.
+	chain []*x509.Certificate
+
+	mu      sync.Mutex
+	revoked []x509.RevocationListEntry
+}
+
+// NewCertAuthority creates a self-signed root CA with the given common name, valid for 10 years.
+func NewCertAuthority(commonName string) (*CertAuthority, error) {
+	return newCertAuthority(commonName, nil)
+}
+
+// NewIntermediate creates an intermediate CA signed by the ca.
+func (ca *CertAuthority) NewIntermediate(commonName string) (*CertAuthority, error) {
+	return newCertAuthority(commonName, ca)
+}
+
+func newCertAuthority(commonName string, parent *CertAuthority) (*CertAuthority, error) {
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"httpbulb"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+
+	var chain []*x509.Certificate
+	issuer, issuerKey := template, (*ecdsa.PrivateKey)(nil)
+	if parent != nil {
+		issuer, issuerKey = parent.Cert, parent.Key
+		chain = append([]*x509.Certificate{parent.Cert}, parent.chain...)
+	}
+
+	cert, key, err := createCertificate(template, issuer, issuerKey)
+	if err != nil {
+		return nil, err
+	}
+	return &CertAuthority{Cert: cert, Key: key, chain: chain}, nil
+}
+
+// createCertificate generates a key and creates the certificate signed by the issuer.
+// If issuerKey is nil, the certificate is self-signed.
+func createCertificate(template, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if issuerKey == nil {
+		issuerKey = key
+	}
+
+	if template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127)); err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// Root returns the root certificate of the ca.
+func (ca *CertAuthority) Root() *x509.Certificate {
+	if len(ca.chain) > 0 {
+		return ca.chain[len(ca.chain)-1]
+	}
+	return ca.Cert
+}
+
+// Pool returns a certificate pool with the root certificate of the ca.
+func (ca *CertAuthority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Root())
+	return pool
+}
+
+// RootPEM returns the root certificate of the ca in PEM format.
+func (ca *CertAuthority) RootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root().Raw})
+}
+
+// ServerCertOptions are the options of `CertAuthority.IssueServerCert`.
+type ServerCertOptions struct {
+	// Hosts are DNS names and IP addresses of the certificate.
+	Hosts []string
+	// NotBefore and NotAfter set the validity period, by default it is from an hour ago to a year ahead.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// CRLDistributionPoints are URLs of the certificate revocation lists.
+	CRLDistributionPoints []string
+}
+
+// IssueServerCert issues a server certificate for the given hosts.
+// The returned certificate contains the chain of intermediate CAs.
+func (ca *CertAuthority) IssueServerCert(opts ServerCertOptions) (tls.Certificate, error) {
+	now := time.Now()
+	if opts.NotBefore.IsZero() {
+		opts.NotBefore = now.Add(-time.Hour)
+	}
+	if opts.NotAfter.IsZero() {
+		opts.NotAfter = now.AddDate(1, 0, 0)
+	}
+
+	template := &x509.Certificate{
+		NotBefore:             opts.NotBefore,
+		NotAfter:              opts.NotAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		CRLDistributionPoints: opts.CRLDistributionPoints,
+	}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(opts.Hosts) > 0 {
+		template.Subject = pkix.Name{CommonName: opts.Hosts[0]}
+	}
+
+	cert, key, err := createCertificate(template, ca.Cert, ca.Key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	tlsCert := tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+	if len(ca.chain) > 0 {
+		// intermediates are sent, the root certificate is not.
+		tlsCert.Certificate = append(tlsCert.Certificate, ca.Cert.Raw)
+		for _, c := range ca.chain[:len(ca.chain)-1] {
+			tlsCert.Certificate = append(tlsCert.Certificate, c.Raw)
+		}
+	}
+	return tlsCert, nil
+}
+
+// Revoke adds the certificate to the certificate revocation list of the ca.
+func (ca *CertAuthority) Revoke(cert *x509.Certificate) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.revoked = append(ca.revoked, x509.RevocationListEntry{
+		SerialNumber:   cert.SerialNumber,
+		RevocationTime: time.Now(),
+	})
+}
+
+// CRL returns the certificate revocation list of the ca in DER format.
+func (ca *CertAuthority) CRL() ([]byte, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	now := time.Now()
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: ca.revoked,
+		Number:                    big.NewInt(now.Unix()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(24 * time.Hour),
+	}
+	return x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"embed"
 	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -30,6 +33,74 @@ type config struct {
 	WriteTimeout time.Duration `env:"WRITE_TIMEOUT" envDefault:"120s"`
 	CertPath     string        `env:"CERT_PATH"`
 	KeyPath      string        `env:"KEY_PATH"`
+	HTTPAddr     string        `env:"HTTP_ADDR"`
+	ClientCAPath string        `env:"CLIENT_CA_PATH"`
+	ClientAuth   string        `env:"CLIENT_AUTH"`
+	H2C          bool          `env:"H2C"`
+	GRPC         bool          `env:"GRPC"`
+	RawCapture   bool          `env:"RAW_CAPTURE" envDefault:"true"`
+	ConnTracking bool          `env:"CONN_TRACKING" envDefault:"true"`
+
+	TLSAuto       bool     `env:"TLS_AUTO"`
+	TLSAutoHosts  []string `env:"TLS_AUTO_HOSTS" envDefault:"localhost,127.0.0.1"`
+	TLSAutoCAPath string   `env:"TLS_AUTO_CA_PATH"`
+
+	BadSSLPort   int      `env:"BADSSL_PORT"`
+	BadSSLHosts  []string `env:"BADSSL_HOSTS"`
+	BadSSLCAPath string   `env:"BADSSL_CA_PATH"`
+
+	StreamMaxMessages int `env:"STREAM_MAX_MESSAGES" envDefault:"100"`
+
+	MultipartMaxMemory    int64 `env:"MULTIPART_MAX_MEMORY"`
+	MultipartContentLimit int64 `env:"MULTIPART_CONTENT_LIMIT"`
+
+	MaxDecompressedBodySize int64 `env:"MAX_DECOMPRESSED_BODY_SIZE"`
+
+	JWTSecret    string `env:"JWT_SECRET"`
+	DigestStrict bool   `env:"DIGEST_STRICT"`
+
+	AWSKeys           map[string]string `env:"AWS_KEYS"`
+	HTTPSignatureKeys map[string]string `env:"HTTP_SIGNATURE_KEYS"`
+
+	APIKeys      []string `env:"API_KEYS"`
+	APIKeyHeader string   `env:"API_KEY_HEADER"`
+	APIKeyQuery  string   `env:"API_KEY_QUERY"`
+	APIKeyCookie string   `env:"API_KEY_COOKIE"`
+
+	SessionUsers map[string]string `env:"SESSION_USERS"`
+
+	SignedCookieKey string `env:"SIGNED_COOKIE_KEY"`
+}
+
+// serve listens on the server address and serves requests with TLS if useTLS is true.
+// Requests are recorded as they are received on the wire for `/raw` and connections are tracked
+// for `/connection` if it is enabled by cfg.
+func serve(srv *http.Server, useTLS bool, cfg config) error {
+	if cfg.ConnTracking {
+		httpbulb.ConfigureConnTracking(srv)
+	}
+	if cfg.RawCapture {
+		if err := httpbulb.ConfigureRawCapture(srv); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cfg.RawCapture && useTLS:
+		// the listener terminates TLS, so HTTP/1.x over TLS is recorded in the plain text
+		return srv.Serve(httpbulb.NewRawTLSListener(ln, srv.TLSConfig))
+	case cfg.RawCapture:
+		ln = httpbulb.NewRawListener(ln)
+	}
+
+	if useTLS {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
 }
 
 func getTLSConfig(certPath, keyPath string) (tlsConfig *tls.Config, err error) {
@@ -43,6 +114,68 @@ func getTLSConfig(certPath, keyPath string) (tlsConfig *tls.Config, err error) {
 	return
 }
 
+// getAutoTLSConfig generates an ephemeral CA and a server certificate for the given hosts.
+func getAutoTLSConfig(hosts []string) (tlsConfig *tls.Config, ca *httpbulb.CertAuthority, err error) {
+	if ca, err = httpbulb.NewCertAuthority("httpbulb CA"); err != nil {
+		return
+	}
+	cert, err := ca.IssueServerCert(httpbulb.ServerCertOptions{Hosts: hosts})
+	if err != nil {
+		return
+	}
+	tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	return
+}
+
+func getClientCAs(caPath string) (pool *x509.CertPool, err error) {
+	if caPath == "" {
+		return
+	}
+	data, err := os.ReadFile(caPath)
+	if err != nil {
+		return
+	}
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		err = fmt.Errorf("no certificates found in %s", caPath)
+	}
+	return
+}
+
+// startBadSSL starts badssl-style listeners on consecutive ports from `SERVER_BADSSL_PORT`.
+// If ca is nil, the listeners use their own ephemeral CA.
+func startBadSSL(cfg config, handler http.Handler, ca *httpbulb.CertAuthority) (*httpbulb.BadTLSServers, error) {
+	host := cfg.Host
+	if host == "" {
+		// listen on all interfaces as the main server does
+		host = "0.0.0.0"
+	}
+	servers, err := httpbulb.StartBadTLSServers(handler, httpbulb.BadTLSOptions{
+		Host:  host,
+		Port:  cfg.BadSSLPort,
+		Hosts: cfg.BadSSLHosts,
+		CA:    ca,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.BadSSLCAPath != "" {
+		if err = os.WriteFile(cfg.BadSSLCAPath, servers.CA.RootPEM(), 0o644); err != nil {
+			servers.Close()
+			return nil, err
+		}
+		log.Printf("[INFO] %s: badssl CA is written to %s\n", logPrefix, cfg.BadSSLCAPath)
+	}
+
+	for _, name := range httpbulb.BadTLSCases {
+		log.Printf("[INFO] %s: badssl %s: %s\n", logPrefix, name, servers.URLs[name])
+	}
+	return servers, nil
+}
+
 func main() {
 	cfg := config{}
 	opts := env.Options{Prefix: "SERVER_"}
@@ -55,36 +188,138 @@ func main() {
 
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	r := httpbulb.NewRouter(middleware.Logger, middleware.Recoverer, httpbulb.Cors)
+	clientCAs, err := getClientCAs(cfg.ClientCAPath)
+	if err != nil {
+		log.Fatalf("[ERROR] %s: can't load client CA: %v\n", logPrefix, err)
+	}
+
+	routerCfg := httpbulb.Config{
+		StreamMaxMessages:       cfg.StreamMaxMessages,
+		MultipartMaxMemory:      cfg.MultipartMaxMemory,
+		MultipartContentLimit:   cfg.MultipartContentLimit,
+		MaxDecompressedBodySize: cfg.MaxDecompressedBodySize,
+		JWTSecret:               []byte(cfg.JWTSecret),
+		ClientCAs:               clientCAs,
+		DigestStrict:            cfg.DigestStrict,
+		AWSKeys:                 cfg.AWSKeys,
+		APIKeys:                 cfg.APIKeys,
+		APIKeyHeader:            cfg.APIKeyHeader,
+		APIKeyQuery:             cfg.APIKeyQuery,
+		APIKeyCookie:            cfg.APIKeyCookie,
+	}
+
+	if len(cfg.SessionUsers) > 0 {
+		routerCfg.Sessions = httpbulb.NewSessionStore()
+		routerCfg.Sessions.Users = cfg.SessionUsers
+	}
+
+	if cfg.SignedCookieKey != "" {
+		routerCfg.SignedCookies = httpbulb.NewSignedCookieStore()
+		routerCfg.SignedCookies.Key = []byte(cfg.SignedCookieKey)
+	}
+
+	for id, secret := range cfg.HTTPSignatureKeys {
+		routerCfg.HTTPSignatureKeys = append(routerCfg.HTTPSignatureKeys,
+			httpbulb.HTTPSignatureKey{ID: id, Key: []byte(secret)})
+	}
+
+	var ca *httpbulb.CertAuthority
+	tlsConfig, err := getTLSConfig(cfg.CertPath, cfg.KeyPath)
+
+	if err != nil && cfg.TLSAuto {
+		log.Printf("[INFO] %s: generating TLS certificates for %v\n", logPrefix, cfg.TLSAutoHosts)
+		if tlsConfig, ca, err = getAutoTLSConfig(cfg.TLSAutoHosts); err != nil {
+			log.Fatalf("[ERROR] %s: can't generate TLS certificates: %v\n", logPrefix, err)
+		}
+		if cfg.TLSAutoCAPath != "" {
+			if err = os.WriteFile(cfg.TLSAutoCAPath, ca.RootPEM(), 0o644); err != nil {
+				log.Fatalf("[ERROR] %s: can't write CA certificate: %v\n", logPrefix, err)
+			}
+			log.Printf("[INFO] %s: CA certificate is written to %s\n", logPrefix, cfg.TLSAutoCAPath)
+		}
+	} else if err != nil {
+		log.Printf("[WARNING] %s: can't load TLS certificates: %v\n", logPrefix, err)
+	}
+
+	r := httpbulb.NewRouterWithConfig(routerCfg, middleware.Logger, middleware.Recoverer, httpbulb.Cors)
 
 	r.Get("/", httpbulb.IndexHandle)
 	r.Mount("/static", http.FileServer(http.FS(distFS)))
 
+	if ca != nil {
+		// the generated CA certificate, so clients can trust the server
+		r.Get("/ca.pem", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-pem-file")
+			w.Write(ca.RootPEM())
+		})
+	}
+
+	var handler http.Handler = r
+
+	if cfg.GRPC {
+		// gRPC requires HTTP/2, so it works only with TLS or h2c enabled
+		log.Printf("[INFO] %s: gRPC Enabled\n", logPrefix)
+		handler = httpbulb.NewGRPCHandler(httpbulb.NewGRPCServer(), handler)
+	}
+
+	if cfg.H2C {
+		log.Printf("[INFO] %s: H2C Enabled\n", logPrefix)
+		handler = httpbulb.NewH2CHandler(handler)
+	}
+
 	srv := &http.Server{
 		Addr:         cfg.Addr,
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
-		Handler:      r,
+		Handler:      handler,
 	}
 
 	type serverListenFn func() error
 
 	var listenAndServe serverListenFn
 
-	tlsConfig, err := getTLSConfig(cfg.CertPath, cfg.KeyPath)
-
-	if err != nil {
-		log.Printf("[WARNING] %s: can't load TLS certificates: %v\n", logPrefix, err)
-	}
+	// httpSrv serves plain HTTP along with HTTPS, if `SERVER_HTTP_ADDR` is set.
+	var httpSrv *http.Server
 
 	if tlsConfig != nil {
 		log.Printf("[INFO] %s: TLS Enabled\n", logPrefix)
+		if clientCAs != nil || cfg.ClientAuth != "" {
+			if tlsConfig.ClientAuth, err = httpbulb.ClientAuthType(cfg.ClientAuth); err != nil {
+				log.Fatalf("[ERROR] %s: %v\n", logPrefix, err)
+			}
+			if tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert && clientCAs == nil {
+				log.Fatalf("[ERROR] %s: client auth mode %q requires SERVER_CLIENT_CA_PATH\n", logPrefix, cfg.ClientAuth)
+			}
+			tlsConfig.ClientCAs = clientCAs
+			log.Printf("[INFO] %s: Client certificates are requested (%s)\n", logPrefix, tlsConfig.ClientAuth)
+		}
 		srv.TLSConfig = tlsConfig
 		listenAndServe = func() error {
-			return srv.ListenAndServeTLS("", "")
+			return serve(srv, true, cfg)
+		}
+		if cfg.HTTPAddr != "" {
+			httpSrv = &http.Server{
+				Addr:         cfg.HTTPAddr,
+				ReadTimeout:  cfg.ReadTimeout,
+				WriteTimeout: cfg.WriteTimeout,
+				Handler:      handler,
+			}
 		}
 	} else {
-		listenAndServe = srv.ListenAndServe
+		if cfg.ClientCAPath != "" || cfg.ClientAuth != "" {
+			log.Fatalf("[ERROR] %s: SERVER_CLIENT_CA_PATH and SERVER_CLIENT_AUTH require TLS\n", logPrefix)
+		}
+		listenAndServe = func() error {
+			return serve(srv, false, cfg)
+		}
+	}
+
+	var badSSL *httpbulb.BadTLSServers
+	if cfg.BadSSLPort > 0 {
+		badSSL, err = startBadSSL(cfg, handler, ca)
+		if err != nil {
+			log.Fatalf("[ERROR] %s: can't start badssl listeners: %v\n", logPrefix, err)
+		}
 	}
 
 	go func() {
@@ -97,11 +332,30 @@ func main() {
 		log.Printf("[INFO] %s: STOPPED SERVING\n", logPrefix)
 	}()
 
+	if httpSrv != nil {
+		go func() {
+			log.Printf("[INFO] %s: START SERVING HTTP ON %s\n", logPrefix, cfg.HTTPAddr)
+			if err := serve(httpSrv, false, cfg); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("[WARNING] %s: %v\n", logPrefix, err)
+			}
+		}()
+	} else if cfg.HTTPAddr != "" {
+		log.Printf("[WARNING] %s: SERVER_HTTP_ADDR is ignored, TLS is not enabled\n", logPrefix)
+	}
+
 	<-stop
 	log.Printf("[INFO] %s: shutting down...\n", logPrefix)
 	if err = srv.Shutdown(context.Background()); err != nil {
 		log.Fatalf("[ERROR] %s: shutdown %v\n", logPrefix, err)
 	}
+	if httpSrv != nil {
+		if err = httpSrv.Shutdown(context.Background()); err != nil {
+			log.Fatalf("[ERROR] %s: shutdown %v\n", logPrefix, err)
+		}
+	}
+	if badSSL != nil {
+		badSSL.Close()
+	}
 
 	log.Printf("[INFO] %s: gracefully stopped\n", logPrefix)
 }
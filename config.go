@@ -0,0 +1,148 @@
+package httpbulb
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+const (
+	defaultStreamMaxMessages = 100
+	defaultAPIKeyHeader      = "X-API-Key"
+	defaultAPIKeyQuery       = "api_key"
+	defaultAPIKeyCookie      = "api_key"
+	defaultMultipartMemory   = 64 << 20
+	defaultMultipartContent  = 1 << 20
+	defaultMaxDecompressed   = 32 << 20
+)
+
+type configKey struct{}
+
+// defaultConfig is used by handlers, which are served without the router.
+var defaultConfig = DefaultConfig()
+
+// Config is the router configuration, it is used by `NewRouterWithConfig`.
+// Zero values are replaced by defaults.
+type Config struct {
+	// StreamMaxMessages is the maximum number of messages sent by `/stream/{n}`. Default is 100.
+	StreamMaxMessages int
+	// PollBroker keeps messages for `/poll/{channel}` endpoints,
+	// it also allows to publish messages from the Go code. If nil, a new broker is created.
+	PollBroker *PollBroker
+	// JWTSecret is the secret to verify HS256 tokens on `/bearer/jwt`. If empty, HS256 tokens are rejected.
+	JWTSecret []byte
+	// JWTKeys are the keys to verify RS256 and ES256 tokens on `/bearer/jwt`,
+	// they are published at `/.well-known/jwks.json`.
+	JWTKeys []JWTKey
+	// OAuth is the stub OAuth2 / OpenID Connect provider served under `/oauth`.
+	// If nil, a new provider is created.
+	OAuth *OAuthProvider
+	// ClientCAs is the pool to verify client certificates on `/tls/client-cert`,
+	// if the server doesn't verify them during the handshake.
+	ClientCAs *x509.CertPool
+	// DigestStrict enables the strict mode of `/digest-auth` for all requests:
+	// nonces are validated on the server. Otherwise it is enabled by `strict=true` query parameter.
+	DigestStrict bool
+	// DigestNonces keeps nonces issued by `/digest-auth` in the strict mode.
+	// If nil, a store with 5 minutes nonce lifetime is created.
+	DigestNonces *DigestNonceStore
+	// AWSKeys maps AWS access key ids to secret keys, they verify AWS Signature Version 4 on `/aws-sigv4`.
+	AWSKeys map[string]string
+	// HTTPSignatureKeys are the keys to verify HTTP Message Signatures (RFC 9421) on `/http-signature`.
+	HTTPSignatureKeys []HTTPSignatureKey
+	// APIKeys are the valid keys for `/api-key`.
+	APIKeys []string
+	// APIKeyHeader is the header with the API key. Default is `X-API-Key`.
+	APIKeyHeader string
+	// APIKeyQuery is the query parameter with the API key. Default is `api_key`.
+	APIKeyQuery string
+	// APIKeyCookie is the cookie with the API key. Default is `api_key`.
+	APIKeyCookie string
+	// Sessions keeps login sessions and CSRF tokens of `/login`. If nil, a new store is created.
+	Sessions *SessionStore
+	// MultipartMaxMemory is the maximum number of bytes of multipart forms kept in memory,
+	// the rest of the files is stored on disk. Default is 64 MiB.
+	MultipartMaxMemory int64
+	// MultipartContentLimit is the maximum size of an uploaded file, which content is returned in `files`.
+	// Default is 1 MiB, a negative value disables the content.
+	MultipartContentLimit int64
+	// MaxDecompressedBodySize is the maximum size of a compressed request body after decoding,
+	// larger bodies are rejected with 413 to protect from decompression bombs. Default is 32 MiB.
+	MaxDecompressedBodySize int64
+	// SignedCookies signs and encrypts cookies of `/cookies/signed`. If nil, a store with a random key is created.
+	SignedCookies *SignedCookieStore
+}
+
+// DefaultConfig returns the configuration used by `NewRouter`.
+func DefaultConfig() Config {
+	return Config{}.withDefaults()
+}
+
+func (c Config) withDefaults() Config {
+	if c.StreamMaxMessages <= 0 {
+		c.StreamMaxMessages = defaultStreamMaxMessages
+	}
+	if c.PollBroker == nil {
+		c.PollBroker = NewPollBroker(0)
+	}
+	if c.OAuth == nil {
+		c.OAuth = NewOAuthProvider()
+	}
+	if c.DigestNonces == nil {
+		c.DigestNonces = NewDigestNonceStore(0)
+	}
+	if c.Sessions == nil {
+		c.Sessions = NewSessionStore()
+	}
+	if c.MultipartMaxMemory <= 0 {
+		c.MultipartMaxMemory = defaultMultipartMemory
+	}
+	if c.MultipartContentLimit == 0 {
+		c.MultipartContentLimit = defaultMultipartContent
+	}
+	if c.MaxDecompressedBodySize <= 0 {
+		c.MaxDecompressedBodySize = defaultMaxDecompressed
+	}
+	if c.SignedCookies == nil {
+		c.SignedCookies = NewSignedCookieStore()
+	}
+	if c.APIKeyHeader == "" {
+		c.APIKeyHeader = defaultAPIKeyHeader
+	}
+	if c.APIKeyQuery == "" {
+		c.APIKeyQuery = defaultAPIKeyQuery
+	}
+	if c.APIKeyCookie == "" {
+		c.APIKeyCookie = defaultAPIKeyCookie
+	}
+	return c
+}
+
+// jwtKeys returns all keys which can verify JWT: the configured keys and the OAuth provider key.
+func (c *Config) jwtKeys() []JWTKey {
+	keys := append([]JWTKey{}, c.JWTKeys...)
+	if c.OAuth != nil {
+		keys = append(keys, c.OAuth.key())
+	}
+	return keys
+}
+
+// withConfig is a middleware that makes the router configuration available to handlers.
+func withConfig(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), configKey{}, &cfg)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// getConfig returns the router configuration,
+// if the handler is used without the router, it returns the default configuration.
+func getConfig(r *http.Request) *Config {
+	if cfg, ok := r.Context().Value(configKey{}).(*Config); ok {
+		return cfg
+	}
+	return &defaultConfig
+}
@@ -0,0 +1,161 @@
+package httpbulb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// connectHTTPStatuses maps gRPC status codes to HTTP status codes as the Connect protocol requires.
+var connectHTTPStatuses = []int{
+	http.StatusOK, 499, http.StatusInternalServerError, http.StatusBadRequest,
+	http.StatusGatewayTimeout, http.StatusNotFound, http.StatusConflict, http.StatusForbidden,
+	http.StatusTooManyRequests, http.StatusBadRequest, http.StatusConflict, http.StatusBadRequest,
+	http.StatusNotImplemented, http.StatusInternalServerError, http.StatusServiceUnavailable,
+	http.StatusInternalServerError, http.StatusUnauthorized,
+}
+
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type connectEndStream struct {
+	Error    *connectError       `json:"error,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+}
+
+// ConnectHandle echoes Connect protocol requests.
+// It can be used as a base URL (`/connect`) for any Connect client: the procedure name is ignored,
+// every received message is sent back as is, so the client can decode it with the same message type.
+// It supports unary requests (`POST` with `application/json` or `application/proto` content-type and `GET`)
+// and streaming requests (`application/connect+json`, `application/connect+proto`).
+//
+// The request metadata is echoed in the response headers.
+// `Bulb-Status` (a code number or name) and `Bulb-Message` request headers set the returned error,
+// `Bulb-Trailer` (`key: value`) request headers add trailers to the response.
+func ConnectHandle(w http.ResponseWriter, r *http.Request) {
+	code, message, err := parseRPCStatus(r.Header)
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	trailers, err := parseRPCTrailers(r.Header)
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for k, vv := range rpcEchoMetadata(r.Header) {
+		w.Header()[k] = vv
+	}
+
+	ct := r.Header.Get("Content-Type")
+	if r.Method == http.MethodPost && strings.HasPrefix(ct, "application/connect+") {
+		connectStreamHandle(w, r, ct, code, message, trailers)
+		return
+	}
+	connectUnaryHandle(w, r, code, message, trailers)
+}
+
+func connectUnaryHandle(w http.ResponseWriter, r *http.Request, code codes.Code, message string, trailers http.Header) {
+	var ct string
+	var payload []byte
+	var compression string
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if query.Get("encoding") == "" {
+			code, message = codes.InvalidArgument, "encoding: missing query parameter"
+		}
+		ct = "application/" + query.Get("encoding")
+		compression = query.Get("compression")
+		payload = []byte(query.Get("message"))
+
+		if query.Get("base64") == "1" {
+			payload, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(query.Get("message"), "="))
+		}
+	case http.MethodPost:
+		ct = r.Header.Get("Content-Type")
+		compression = r.Header.Get("Content-Encoding")
+		payload, err = io.ReadAll(io.LimitReader(r.Body, rpcMaxMessageSize+1))
+		if err == nil && len(payload) > rpcMaxMessageSize {
+			code, message = codes.ResourceExhausted, "message size exceeds the limit"
+		}
+	default:
+		code, message = codes.Unimplemented, "method must be GET or POST"
+	}
+
+	if err != nil {
+		code, message = codes.InvalidArgument, err.Error()
+	}
+
+	if compression != "" && compression != "identity" && code == codes.OK {
+		code, message = codes.Unimplemented, "compression is not supported: "+compression
+	}
+
+	for k, vv := range trailers {
+		w.Header()["Trailer-"+k] = vv
+	}
+
+	if code != codes.OK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(connectHTTPStatuses[code])
+		json.NewEncoder(w).Encode(&connectError{Code: connectCodeNames[code], Message: message})
+		return
+	}
+
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+func connectStreamHandle(w http.ResponseWriter, r *http.Request, ct string, code codes.Code, message string, trailers http.Header) {
+	envelopes, err := readRPCEnvelopes(r.Body)
+	if err != nil && code == codes.OK {
+		code, message = codes.InvalidArgument, err.Error()
+	}
+
+	if compression := r.Header.Get("Connect-Content-Encoding"); compression != "" && compression != "identity" {
+		code, message = codes.Unimplemented, "compression is not supported: "+compression
+	}
+
+	for _, env := range envelopes {
+		if env.flags&envelopeFlagCompressed != 0 && code == codes.OK {
+			code, message = codes.Unimplemented, "compressed messages are not supported"
+		}
+	}
+
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(http.StatusOK)
+
+	buf := new(bytes.Buffer)
+	if code == codes.OK {
+		for _, env := range envelopes {
+			if env.flags&envelopeFlagEndStream == 0 {
+				writeRPCEnvelope(buf, 0, env.payload)
+			}
+		}
+	}
+
+	endStream := connectEndStream{}
+	if code != codes.OK {
+		endStream.Error = &connectError{Code: connectCodeNames[code], Message: message}
+	}
+	if len(trailers) > 0 {
+		endStream.Metadata = trailers
+	}
+
+	endStreamPayload, _ := json.Marshal(&endStream)
+	writeRPCEnvelope(buf, envelopeFlagEndStream, endStreamPayload)
+
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,226 @@
+package httpbulb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConnectSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	client     *http.Client
+}
+
+func (s *ConnectSuite) SetupSuite() {
+	s.testServer = httptest.NewServer(NewRouter())
+	s.client = http.DefaultClient
+}
+
+func (s *ConnectSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func (s *ConnectSuite) TestUnary() {
+	type testArgs struct {
+		name            string
+		method          string
+		contentType     string
+		query           url.Values
+		body            string
+		headers         http.Header
+		wantStatusCode  int
+		wantContentType string
+		wantBody        string
+		wantErrCode     string
+		wantErrMessage  string
+		wantHeaders     http.Header
+	}
+
+	tests := []testArgs{
+		{
+			name:            "echo json",
+			method:          http.MethodPost,
+			contentType:     "application/json",
+			body:            `{"message":"hello"}`,
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"message":"hello"}`,
+		},
+		{
+			name:            "echo proto with trailers",
+			method:          http.MethodPost,
+			contentType:     "application/proto",
+			body:            "\x0a\x05hello",
+			headers:         http.Header{"Bulb-Trailer": {"x-trailer: value"}},
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "application/proto",
+			wantBody:        "\x0a\x05hello",
+			wantHeaders:     http.Header{"Trailer-X-Trailer": {"value"}},
+		},
+		{
+			name:            "echo get",
+			method:          http.MethodGet,
+			query:           url.Values{"encoding": {"json"}, "message": {`{"message":"hello"}`}},
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"message":"hello"}`,
+		},
+		{
+			name:   "echo get base64",
+			method: http.MethodGet,
+			query: url.Values{
+				"encoding": {"proto"},
+				"base64":   {"1"},
+				"message":  {base64.RawURLEncoding.EncodeToString([]byte("\x0a\x05hello"))},
+			},
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "application/proto",
+			wantBody:        "\x0a\x05hello",
+		},
+		{
+			name:           "error",
+			method:         http.MethodPost,
+			contentType:    "application/json",
+			body:           `{}`,
+			headers:        http.Header{"Bulb-Status": {"permission_denied"}, "Bulb-Message": {"go away"}},
+			wantStatusCode: http.StatusForbidden,
+			wantErrCode:    "permission_denied",
+			wantErrMessage: "go away",
+		},
+		{
+			name:           "compressed",
+			method:         http.MethodPost,
+			contentType:    "application/json",
+			body:           `{}`,
+			headers:        http.Header{"Content-Encoding": {"gzip"}},
+			wantStatusCode: http.StatusNotImplemented,
+			wantErrCode:    "unimplemented",
+		},
+		{
+			name:           "get without encoding",
+			method:         http.MethodGet,
+			query:          url.Values{"message": {`{}`}},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrCode:    "invalid_argument",
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			apiURL := s.testServer.URL + "/connect/test.Service/Method"
+			if tt.query != nil {
+				apiURL += "?" + tt.query.Encode()
+			}
+
+			req, err := http.NewRequest(tt.method, apiURL, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header[k] = v
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set("X-Metadata", "echo")
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			require.Equal(t, "echo", resp.Header.Get("X-Metadata"))
+			require.Subset(t, resp.Header, tt.wantHeaders)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			if tt.wantErrCode != "" {
+				result := new(connectError)
+				require.NoError(t, json.Unmarshal(body, result))
+				require.Equal(t, tt.wantErrCode, result.Code)
+				if tt.wantErrMessage != "" {
+					require.Equal(t, tt.wantErrMessage, result.Message)
+				}
+				return
+			}
+
+			require.Equal(t, tt.wantContentType, resp.Header.Get("Content-Type"))
+			require.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+func (s *ConnectSuite) TestStream() {
+	type testArgs struct {
+		name         string
+		headers      http.Header
+		wantMessages []string
+		wantError    *connectError
+		wantMetadata map[string][]string
+	}
+
+	messages := []string{`{"message":"a"}`, `{"message":"b"}`}
+
+	tests := []testArgs{
+		{name: "echo", wantMessages: messages},
+		{
+			name:         "error with trailers",
+			headers:      http.Header{"Bulb-Status": {"14"}, "Bulb-Trailer": {"x-trailer: value"}},
+			wantError:    &connectError{Code: "unavailable", Message: "unavailable"},
+			wantMetadata: map[string][]string{"X-Trailer": {"value"}},
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			body := new(bytes.Buffer)
+			for _, m := range messages {
+				writeRPCEnvelope(body, 0, []byte(m))
+			}
+			writeRPCEnvelope(body, envelopeFlagEndStream, []byte("{}"))
+
+			req, err := http.NewRequest(http.MethodPost, s.testServer.URL+"/connect/test.Service/Stream", body)
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header[k] = v
+			}
+			req.Header.Set("Content-Type", "application/connect+json")
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "application/connect+json", resp.Header.Get("Content-Type"))
+
+			envelopes, err := readRPCEnvelopes(resp.Body)
+			require.NoError(t, err)
+			require.Len(t, envelopes, len(tt.wantMessages)+1)
+
+			for i, m := range tt.wantMessages {
+				require.Equal(t, m, string(envelopes[i].payload))
+			}
+
+			last := envelopes[len(envelopes)-1]
+			require.Equal(t, envelopeFlagEndStream, last.flags)
+
+			endStream := new(connectEndStream)
+			require.NoError(t, json.Unmarshal(last.payload, endStream))
+			require.Equal(t, tt.wantError, endStream.Error)
+			require.Equal(t, tt.wantMetadata, endStream.Metadata)
+		})
+	}
+}
+
+func TestConnectSuite(t *testing.T) {
+	suite.Run(t, new(ConnectSuite))
+}
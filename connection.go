@@ -0,0 +1,111 @@
+package httpbulb
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type connInfoKey struct{}
+
+type connRequestKey struct{}
+
+// connTracker assigns ids to connections of a server and counts open connections.
+type connTracker struct {
+	lastID atomic.Uint64
+	open   atomic.Int64
+}
+
+// connInfo is kept in the connection context.
+type connInfo struct {
+	id          uint64
+	requests    atomic.Int64
+	localAddr   string
+	remoteAddr  string
+	connectedAt time.Time
+	tracker     *connTracker
+}
+
+// ConfigureConnTracking configures the server to tag every connection with an id and to count its requests
+// by `http.Server.ConnContext` and `http.Server.ConnState`.
+// The connection details are returned by `/connection` and in the `connection` field of the methods response.
+//
+// Hijacked connections (e.g. h2c) keep their id, but they are not counted as open connections.
+func ConfigureConnTracking(srv *http.Server) {
+	tracker := &connTracker{}
+
+	connContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		info := &connInfo{
+			id:          tracker.lastID.Add(1),
+			localAddr:   c.LocalAddr().String(),
+			remoteAddr:  c.RemoteAddr().String(),
+			connectedAt: time.Now(),
+			tracker:     tracker,
+		}
+		return context.WithValue(ctx, connInfoKey{}, info)
+	}
+
+	connState := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		if connState != nil {
+			connState(c, state)
+		}
+		switch state {
+		case http.StateNew:
+			tracker.open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			tracker.open.Add(-1)
+		}
+	}
+}
+
+// trackConn is a middleware, which counts requests of the connection.
+func trackConn(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(connInfoKey{}).(*connInfo); ok {
+			n := info.requests.Add(1)
+			conn := &ConnectionInfo{
+				ID:              info.id,
+				Request:         n,
+				Reused:          n > 1,
+				LocalAddr:       info.localAddr,
+				RemoteAddr:      info.remoteAddr,
+				Proto:           r.Proto,
+				ConnectedAt:     info.connectedAt,
+				OpenConnections: info.tracker.open.Load(),
+			}
+			if raw := getRawRequest(r); raw != nil {
+				conn.StreamID = raw.StreamID
+			}
+			r = r.WithContext(context.WithValue(r.Context(), connRequestKey{}, conn))
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// getConnectionInfo returns the connection details of the request, or nil if connections are not tracked.
+func getConnectionInfo(r *http.Request) *ConnectionInfo {
+	conn, _ := r.Context().Value(connRequestKey{}).(*ConnectionInfo)
+	return conn
+}
+
+// ConnectionHandle returns the connection id, the number of the request on the connection,
+// whether the connection was reused, local and remote addresses and the HTTP/2 stream id
+// (if requests are captured, see `NewRawListener`).
+// It returns 501 if connections are not tracked, see `ConfigureConnTracking`.
+func ConnectionHandle(w http.ResponseWriter, r *http.Request) {
+	conn := getConnectionInfo(r)
+	if conn == nil {
+		RenderError(w, "connections are not tracked, the server must be configured by ConfigureConnTracking",
+			http.StatusNotImplemented)
+		return
+	}
+	RenderResponse(w, http.StatusOK, conn)
+}
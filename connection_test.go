@@ -0,0 +1,110 @@
+package httpbulb
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConnectionSuite struct {
+	suite.Suite
+	testServer    *httptest.Server
+	testTLSServer *httptest.Server
+}
+
+func (s *ConnectionSuite) SetupSuite() {
+	s.testServer = httptest.NewUnstartedServer(NewRouter())
+	ConfigureConnTracking(s.testServer.Config)
+	s.testServer.Start()
+
+	s.testTLSServer = httptest.NewUnstartedServer(NewRouter())
+	s.testTLSServer.EnableHTTP2 = true
+	ConfigureConnTracking(s.testTLSServer.Config)
+	s.Require().NoError(ConfigureRawCapture(s.testTLSServer.Config))
+	s.testTLSServer.StartTLS()
+}
+
+func (s *ConnectionSuite) TearDownSuite() {
+	s.testServer.Close()
+	s.testTLSServer.Close()
+}
+
+func (s *ConnectionSuite) getConnection(client *http.Client, url string) *ConnectionInfo {
+	resp, err := client.Get(url + "/connection")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	conn := &ConnectionInfo{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(conn))
+	return conn
+}
+
+func (s *ConnectionSuite) TestKeepAlive() {
+	client := &http.Client{Transport: &http.Transport{}}
+
+	first := s.getConnection(client, s.testServer.URL)
+	second := s.getConnection(client, s.testServer.URL)
+
+	s.Require().Equal(first.ID, second.ID)
+	s.Require().Equal(int64(1), first.Request)
+	s.Require().False(first.Reused)
+	s.Require().Equal(int64(2), second.Request)
+	s.Require().True(second.Reused)
+	s.Require().Equal(s.testServer.Listener.Addr().String(), first.LocalAddr)
+	s.Require().NotEmpty(first.RemoteAddr)
+	s.Require().Equal("HTTP/1.1", first.Proto)
+	s.Require().Zero(first.StreamID)
+	s.Require().GreaterOrEqual(first.OpenConnections, int64(1))
+
+	// a client without keep-alive opens a new connection for every request
+	client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	third := s.getConnection(client, s.testServer.URL)
+	fourth := s.getConnection(client, s.testServer.URL)
+	s.Require().NotEqual(first.ID, third.ID)
+	s.Require().NotEqual(third.ID, fourth.ID)
+	s.Require().False(fourth.Reused)
+}
+
+func (s *ConnectionSuite) TestHTTP2Streams() {
+	client := s.testTLSServer.Client()
+
+	first := s.getConnection(client, s.testTLSServer.URL)
+	second := s.getConnection(client, s.testTLSServer.URL)
+
+	s.Require().Equal("HTTP/2.0", first.Proto)
+	s.Require().Equal(first.ID, second.ID)
+	s.Require().Equal(uint32(1), first.StreamID)
+	s.Require().Equal(uint32(3), second.StreamID)
+	s.Require().True(second.Reused)
+}
+
+func (s *ConnectionSuite) TestMethodsResponse() {
+	resp, err := http.Get(s.testServer.URL + "/get")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	result := &MethodsResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	s.Require().NotNil(result.Connection)
+	s.Require().NotZero(result.Connection.ID)
+}
+
+func (s *ConnectionSuite) TestNotTracked() {
+	ts := httptest.NewServer(NewRouter())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/connection")
+	s.Require().NoError(err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusNotImplemented, resp.StatusCode)
+}
+
+func TestConnectionSuite(t *testing.T) {
+	suite.Run(t, new(ConnectionSuite))
+}
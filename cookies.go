@@ -1,7 +1,15 @@
 package httpbulb
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -22,39 +30,247 @@ func CookiesHandle(w http.ResponseWriter, r *http.Request) {
 	RenderResponse(w, http.StatusOK, resp)
 }
 
-// SetCookiesHandle sets the cookies passed from the query parameters,
-// then redirects to /cookies
-func SetCookiesHandle(w http.ResponseWriter, r *http.Request) {
-	params := r.URL.Query()
+// cookieAttributePrefix is the prefix of query parameters, which set attributes of cookies instead of cookies
+// (`attr.path=/docs`), so any other parameter, including `path`, still sets a cookie.
+const cookieAttributePrefix = "attr."
+
+// cookieAttributes are the names of attributes, which can be set by the query parameters.
+var cookieAttributes = map[string]bool{
+	"path": true, "domain": true, "expires": true, "max_age": true, "secure": true,
+	"http_only": true, "samesite": true, "partitioned": true, "prefix": true,
+}
+
+// cookieSpec describes a cookie to set: in JSON body of `/cookies/set` or in query parameters.
+type cookieSpec struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Path   string `json:"path,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	// Expires is a date in HTTP (RFC 1123) or RFC 3339 format
+	Expires string `json:"expires,omitempty"`
+	// MaxAge is the lifetime in seconds, zero deletes the cookie
+	MaxAge *int `json:"max_age,omitempty"`
+	Secure bool `json:"secure,omitempty"`
+	// HttpOnly is true by default
+	HttpOnly *bool `json:"http_only,omitempty"`
+	// SameSite is one of: Lax, Strict, None
+	SameSite    string `json:"samesite,omitempty"`
+	Partitioned bool   `json:"partitioned,omitempty"`
+	// Prefix is `host` for `__Host-` or `secure` for `__Secure-` prefix
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// cookie returns the cookie with its attributes and reports whether it is partitioned.
+// Attributes required by SameSite=None, Partitioned and cookie name prefixes are enforced.
+func (c cookieSpec) cookie() (cookie *http.Cookie, partitioned bool, err error) {
+	cookie = &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly == nil || *c.HttpOnly,
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	if c.Expires != "" {
+		if cookie.Expires, err = http.ParseTime(c.Expires); err != nil {
+			if cookie.Expires, err = time.Parse(time.RFC3339, c.Expires); err != nil {
+				return nil, false, fmt.Errorf("invalid expires %q", c.Expires)
+			}
+		}
+	}
+	if c.MaxAge != nil {
+		cookie.MaxAge = *c.MaxAge
+		if cookie.MaxAge == 0 {
+			// Max-Age=0
+			cookie.MaxAge = -1
+		}
+	}
+
+	switch strings.ToLower(c.SameSite) {
+	case "":
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+		cookie.Secure = true
+	default:
+		return nil, false, fmt.Errorf("samesite must be one of: Lax, Strict, None")
+	}
+
+	if c.Partitioned {
+		cookie.Secure = true
+	}
+
+	switch strings.ToLower(c.Prefix) {
+	case "":
+	case "host":
+		cookie.Name = "__Host-" + cookie.Name
+	case "secure":
+		cookie.Name = "__Secure-" + cookie.Name
+	default:
+		return nil, false, fmt.Errorf("prefix must be one of: host, secure")
+	}
+	if strings.HasPrefix(cookie.Name, "__Secure-") {
+		cookie.Secure = true
+	}
+	if strings.HasPrefix(cookie.Name, "__Host-") {
+		cookie.Secure = true
+		cookie.Path = "/"
+		cookie.Domain = ""
+	}
+
+	if cookie.String() == "" {
+		return nil, false, fmt.Errorf("invalid cookie name %q", cookie.Name)
+	}
+	return cookie, c.Partitioned, nil
+}
+
+// cookieSpecsFromQuery returns cookies from the query parameters (except `attr.` parameters)
+// with attributes given by `attr.` parameters. If name is not empty, only this cookie is returned.
+func cookieSpecsFromQuery(params url.Values, name, value string) (specs []cookieSpec, err error) {
+	attrParams := make(url.Values)
+	for k, vv := range params {
+		if attr, ok := strings.CutPrefix(k, cookieAttributePrefix); ok {
+			if !cookieAttributes[attr] {
+				return nil, fmt.Errorf("unknown cookie attribute %q", k)
+			}
+			attrParams[attr] = vv
+		}
+	}
+
+	attrs := cookieSpec{
+		Path:        attrParams.Get("path"),
+		Domain:      attrParams.Get("domain"),
+		Expires:     attrParams.Get("expires"),
+		SameSite:    attrParams.Get("samesite"),
+		Prefix:      attrParams.Get("prefix"),
+		Secure:      attrParams.Has("secure") && attrParams.Get("secure") != "false",
+		Partitioned: attrParams.Has("partitioned") && attrParams.Get("partitioned") != "false",
+	}
+	if attrParams.Has("http_only") {
+		httpOnly := attrParams.Get("http_only") != "false"
+		attrs.HttpOnly = &httpOnly
+	}
+	if attrParams.Has("max_age") {
+		maxAge, err := strconv.Atoi(attrParams.Get("max_age"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_age %q", attrParams.Get("max_age"))
+		}
+		attrs.MaxAge = &maxAge
+	}
+
+	if name != "" {
+		attrs.Name, attrs.Value = name, value
+		return []cookieSpec{attrs}, nil
+	}
+
 	for k, vv := range params {
+		if strings.HasPrefix(k, cookieAttributePrefix) {
+			continue
+		}
 		for _, v := range vv {
-			http.SetCookie(w, &http.Cookie{
-				Name:     k,
-				Value:    v,
-				HttpOnly: true,
-				Path:     "/",
-			})
+			spec := attrs
+			spec.Name, spec.Value = k, v
+			specs = append(specs, spec)
 		}
 	}
+	return
+}
 
-	http.Redirect(w, r, "/cookies", http.StatusFound)
+// cookieSpecsFromRequest returns cookies from JSON body (a cookie object or an array of them) of POST requests,
+// or from the query parameters.
+func cookieSpecsFromRequest(r *http.Request) (specs []cookieSpec, err error) {
+	if r.Method != http.MethodPost {
+		return cookieSpecsFromQuery(r.URL.Query(), "", "")
+	}
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &specs)
+	} else {
+		var spec cookieSpec
+		err = json.Unmarshal(body, &spec)
+		specs = []cookieSpec{spec}
+	}
+	return
+}
+
+// setCookies sets the cookies, Partitioned attribute is appended to Set-Cookie header manually.
+func setCookies(w http.ResponseWriter, specs []cookieSpec) error {
+	cookies := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		cookie, partitioned, err := spec.cookie()
+		if err != nil {
+			return err
+		}
+		value := cookie.String()
+		if partitioned {
+			value += "; Partitioned"
+		}
+		cookies = append(cookies, value)
+	}
+	for _, cookie := range cookies {
+		w.Header().Add("Set-Cookie", cookie)
+	}
+	return nil
+}
+
+func setCookiesHandle(w http.ResponseWriter, r *http.Request, specs []cookieSpec, err error, redirect bool) {
+	if err == nil {
+		err = setCookies(w, specs)
+	}
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if redirect {
+		http.Redirect(w, r, "/cookies", http.StatusFound)
+		return
+	}
+	RenderResponse(w, http.StatusOK, SetCookiesResponse{SetCookie: w.Header().Values("Set-Cookie")})
+}
+
+// SetCookiesHandle sets the cookies passed from the query parameters,
+// then redirects to /cookies.
+//
+// Query parameters `attr.path`, `attr.domain`, `attr.expires`, `attr.max_age`, `attr.secure`, `attr.http_only`,
+// `attr.samesite`, `attr.partitioned` and `attr.prefix` (`host` or `secure`) set attributes of all the cookies,
+// any other parameter (e.g. `path`) sets a cookie. A POST request sets cookies from JSON body: a cookie object or an array of them.
+func SetCookiesHandle(w http.ResponseWriter, r *http.Request) {
+	specs, err := cookieSpecsFromRequest(r)
+	setCookiesHandle(w, r, specs, err, true)
 }
 
 // SetCookieHandle sets a cookie with the name and value passed in the URL path,
-// then redirects to /cookies
+// then redirects to /cookies. Attributes are set by the same `attr.` query parameters as `SetCookiesHandle`.
 func SetCookieHandle(w http.ResponseWriter, r *http.Request) {
+	specs, err := cookieSpecsFromQuery(r.URL.Query(), chi.URLParam(r, "name"), chi.URLParam(r, "value"))
+	setCookiesHandle(w, r, specs, err, true)
+}
 
-	name := chi.URLParam(r, "name")
-	value := chi.URLParam(r, "value")
-	http.SetCookie(w, &http.Cookie{
-		Name:     name,
-		Value:    value,
-		HttpOnly: true,
-		Path:     "/",
-	})
-	http.Redirect(w, r, "/cookies", http.StatusFound)
+// SetCookiesNoRedirectHandle sets cookies like `SetCookiesHandle`,
+// but it returns 200 with the Set-Cookie header values instead of redirecting.
+func SetCookiesNoRedirectHandle(w http.ResponseWriter, r *http.Request) {
+	specs, err := cookieSpecsFromRequest(r)
+	setCookiesHandle(w, r, specs, err, false)
+}
 
+// SetCookieNoRedirectHandle sets a cookie like `SetCookieHandle`,
+// but it returns 200 with the Set-Cookie header value instead of redirecting.
+func SetCookieNoRedirectHandle(w http.ResponseWriter, r *http.Request) {
+	specs, err := cookieSpecsFromQuery(r.URL.Query(), chi.URLParam(r, "name"), chi.URLParam(r, "value"))
+	setCookiesHandle(w, r, specs, err, false)
 }
 
 // DeleteCookiesHandle deletes the cookies passed in the query parameters,
@@ -7,8 +7,10 @@ import (
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -189,6 +191,102 @@ func (s *CookiesSuite) TestDeleteCookies() {
 
 }
 
+func (s *CookiesSuite) TestSetCookieAttributes() {
+	type testArgs struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		wantStatusCode int
+		wantSetCookie  []string
+	}
+
+	tests := []testArgs{
+		{name: "default attributes", method: http.MethodGet, path: "/cookies/set-noredirect?k=v",
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"k=v; Path=/; HttpOnly"}},
+		{name: "all attributes", method: http.MethodGet,
+			path: "/cookies/set-noredirect?k=v&attr.path=/docs&attr.domain=example.com&attr.max_age=60&attr.secure&attr.http_only=false" +
+				"&attr.samesite=Strict&attr.expires=Wed,%2021%20Oct%202099%2007:28:00%20GMT",
+			wantStatusCode: http.StatusOK,
+			wantSetCookie: []string{"k=v; Path=/docs; Domain=example.com; Expires=Wed, 21 Oct 2099 07:28:00 GMT; " +
+				"Max-Age=60; Secure; SameSite=Strict"}},
+		{name: "zero max age", method: http.MethodGet, path: "/cookies/set-noredirect/k/v?attr.max_age=0",
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"k=v; Path=/; Max-Age=0; HttpOnly"}},
+		{name: "samesite none is secure", method: http.MethodGet, path: "/cookies/set-noredirect/k/v?attr.samesite=none",
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"k=v; Path=/; HttpOnly; Secure; SameSite=None"}},
+		{name: "partitioned", method: http.MethodGet, path: "/cookies/set-noredirect/k/v?attr.partitioned",
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"k=v; Path=/; HttpOnly; Secure; Partitioned"}},
+		{name: "host prefix", method: http.MethodGet, path: "/cookies/set-noredirect/k/v?attr.prefix=host&attr.path=/docs&attr.domain=example.com",
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"__Host-k=v; Path=/; HttpOnly; Secure"}},
+		{name: "secure prefix in the name", method: http.MethodGet, path: "/cookies/set-noredirect/__Secure-k/v",
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"__Secure-k=v; Path=/; HttpOnly; Secure"}},
+		{name: "attribute names are cookies", method: http.MethodGet, path: "/cookies/set-noredirect?path=x",
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"path=x; Path=/; HttpOnly"}},
+		{name: "json body", method: http.MethodPost, path: "/cookies/set-noredirect",
+			body:           `[{"name":"a","value":"1","samesite":"Lax","max_age":3600},{"name":"b","value":"2","http_only":false,"prefix":"secure"}]`,
+			wantStatusCode: http.StatusOK,
+			wantSetCookie:  []string{"a=1; Path=/; Max-Age=3600; HttpOnly; SameSite=Lax", "__Secure-b=2; Path=/; Secure"}},
+		{name: "json object", method: http.MethodPost, path: "/cookies/set-noredirect",
+			body:           `{"name":"a","value":"1","expires":"2099-10-21T07:28:00Z"}`,
+			wantStatusCode: http.StatusOK, wantSetCookie: []string{"a=1; Path=/; Expires=Wed, 21 Oct 2099 07:28:00 GMT; HttpOnly"}},
+		{name: "invalid samesite", method: http.MethodGet, path: "/cookies/set-noredirect/k/v?attr.samesite=always",
+			wantStatusCode: http.StatusBadRequest},
+		{name: "invalid expires", method: http.MethodGet, path: "/cookies/set-noredirect/k/v?attr.expires=tomorrow",
+			wantStatusCode: http.StatusBadRequest},
+		{name: "unknown attribute", method: http.MethodGet, path: "/cookies/set-noredirect/k/v?attr.color=red",
+			wantStatusCode: http.StatusBadRequest},
+		{name: "invalid name", method: http.MethodPost, path: "/cookies/set-noredirect", body: `{"name":"a b","value":"1"}`,
+			wantStatusCode: http.StatusBadRequest},
+		{name: "invalid json", method: http.MethodPost, path: "/cookies/set-noredirect", body: `{`,
+			wantStatusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, s.testServer.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+
+			require.Equal(t, tt.wantSetCookie, resp.Header.Values("Set-Cookie"))
+			res := &SetCookiesResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+			require.Equal(t, tt.wantSetCookie, res.SetCookie)
+		})
+	}
+}
+
+func (s *CookiesSuite) TestSetCookiesRedirect() {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.Post(s.testServer.URL+"/cookies/set", "application/json",
+		strings.NewReader(`{"name":"k","value":"v","samesite":"Lax"}`))
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusFound, resp.StatusCode)
+	s.Require().Equal("/cookies", resp.Header.Get("Location"))
+	s.Require().Equal("k=v; Path=/; HttpOnly; SameSite=Lax", resp.Header.Get("Set-Cookie"))
+
+	// attribute parameters are not cookies
+	resp, err = client.Get(s.testServer.URL + "/cookies/set?k1=v1&k2=v2&attr.secure=true")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusFound, resp.StatusCode)
+	cookies := resp.Cookies()
+	s.Require().Len(cookies, 2)
+	for _, cookie := range cookies {
+		s.Require().True(cookie.Secure)
+	}
+}
+
 func TestCookiesSuite(t *testing.T) {
 	suite.Run(t, new(CookiesSuite))
 }
@@ -0,0 +1,122 @@
+package httpbulb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// requestEncodings are the supported content codings of request bodies.
+var requestEncodings = []string{"gzip", "deflate", "br", "zstd"}
+
+// countingReader counts bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return
+}
+
+// parseContentEncoding returns the content codings of the request in the order they were applied.
+func parseContentEncoding(h http.Header) (encodings []string) {
+	for _, v := range h.Values("Content-Encoding") {
+		for _, coding := range strings.Split(v, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" || coding == "identity" {
+				continue
+			}
+			if coding == "x-gzip" {
+				coding = "gzip"
+			}
+			encodings = append(encodings, coding)
+		}
+	}
+	return
+}
+
+// newDecompressor returns a reader, which decodes the content coding.
+func newDecompressor(coding string, r io.Reader) (io.ReadCloser, error) {
+	switch coding {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// `deflate` is zlib format, but some clients send raw deflate data
+		br := bufio.NewReader(r)
+		header, _ := br.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", coding)
+}
+
+// decompressBody decodes the request body sent with `Content-Encoding` and replaces it with the decoded body.
+// It returns nil if the body is not compressed.
+// The decoded body larger than limit is rejected with 413, unknown encodings are rejected with 415.
+func decompressBody(r *http.Request, limit int64) (info *RequestEncoding, err error) {
+	encodings := parseContentEncoding(r.Header)
+	if len(encodings) == 0 {
+		return nil, nil
+	}
+	for _, coding := range encodings {
+		if !containsFold(requestEncodings, coding) {
+			return nil, &bodyError{status: http.StatusUnsupportedMediaType,
+				msg: fmt.Sprintf("unsupported content encoding %q, supported: %s", coding, strings.Join(requestEncodings, ", "))}
+		}
+	}
+
+	counter := &countingReader{r: r.Body}
+	var reader io.Reader = counter
+	// codings are decoded in the reverse order
+	for i := len(encodings) - 1; i >= 0; i-- {
+		rc, err := newDecompressor(encodings[i], reader)
+		if err != nil {
+			return nil, &bodyError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid %s body: %v", encodings[i], err)}
+		}
+		defer rc.Close()
+		reader = rc
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, &bodyError{status: http.StatusBadRequest,
+			msg: fmt.Sprintf("invalid %s body: %v", strings.Join(encodings, ", "), err)}
+	}
+	if int64(len(body)) > limit {
+		return nil, &bodyError{status: http.StatusRequestEntityTooLarge,
+			msg: fmt.Sprintf("decompressed body exceeds %d bytes", limit)}
+	}
+	// bytes after the compressed data are counted too
+	io.Copy(io.Discard, io.LimitReader(counter, limit))
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	return &RequestEncoding{
+		Encoding:         strings.Join(encodings, ", "),
+		CompressedSize:   counter.n,
+		DecompressedSize: int64(len(body)),
+	}, nil
+}
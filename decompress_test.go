@@ -0,0 +1,154 @@
+package httpbulb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+type compressFunc func(w io.Writer) io.WriteCloser
+
+func compressData(t *testing.T, data []byte, compressors ...compressFunc) []byte {
+	for _, c := range compressors {
+		buf := new(bytes.Buffer)
+		w := c(buf)
+		_, err := w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		data = buf.Bytes()
+	}
+	return data
+}
+
+var (
+	gzipCompress  compressFunc = func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	zlibCompress  compressFunc = func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+	flateCompress compressFunc = func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}
+	brotliCompress compressFunc = func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }
+	zstdCompress   compressFunc = func(w io.Writer) io.WriteCloser {
+		zw, _ := zstd.NewWriter(w)
+		return zw
+	}
+)
+
+func TestDecompressBody(t *testing.T) {
+	type testArgs struct {
+		name        string
+		encoding    string
+		compressors []compressFunc
+		want        string
+	}
+
+	tests := []testArgs{
+		{name: "gzip", encoding: "gzip", compressors: []compressFunc{gzipCompress}, want: "gzip"},
+		{name: "x-gzip", encoding: "x-gzip", compressors: []compressFunc{gzipCompress}, want: "gzip"},
+		{name: "deflate zlib", encoding: "deflate", compressors: []compressFunc{zlibCompress}, want: "deflate"},
+		{name: "deflate raw", encoding: "deflate", compressors: []compressFunc{flateCompress}, want: "deflate"},
+		{name: "br", encoding: "br", compressors: []compressFunc{brotliCompress}, want: "br"},
+		{name: "zstd", encoding: "zstd", compressors: []compressFunc{zstdCompress}, want: "zstd"},
+		{name: "chained", encoding: "gzip, BR", compressors: []compressFunc{gzipCompress, brotliCompress}, want: "gzip, br"},
+	}
+
+	testServer := httptest.NewServer(NewRouter())
+	defer testServer.Close()
+
+	data := strings.Repeat(`{"key": "value"}`, 100)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := compressData(t, []byte(data), tt.compressors...)
+
+			req, err := http.NewRequest(http.MethodPost, testServer.URL+"/post", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "text/plain")
+			req.Header.Set("Content-Encoding", tt.encoding)
+
+			resp, err := httpClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			result := &MethodsResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			require.Equal(t, data, result.Data)
+			require.Equal(t, &RequestEncoding{
+				Encoding:         tt.want,
+				CompressedSize:   int64(len(body)),
+				DecompressedSize: int64(len(data)),
+			}, result.RequestEncoding)
+		})
+	}
+}
+
+func TestDecompressBodyErrors(t *testing.T) {
+	type testArgs struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantStatus int
+	}
+
+	bomb := compressData(t, bytes.Repeat([]byte{0}, 1<<20), gzipCompress)
+	small := compressData(t, []byte("data"), gzipCompress)
+
+	tests := []testArgs{
+		{name: "unknown encoding", encoding: "compress", body: []byte("data"), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "unknown chained encoding", encoding: "gzip, lzma", body: []byte("data"), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "corrupted gzip", encoding: "gzip", body: []byte("not gzip"), wantStatus: http.StatusBadRequest},
+		{name: "truncated gzip", encoding: "gzip", body: small[:len(small)-4], wantStatus: http.StatusBadRequest},
+		{name: "over the limit", encoding: "gzip", body: bomb, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	testServer := httptest.NewServer(NewRouterWithConfig(Config{MaxDecompressedBodySize: 1 << 10}))
+	defer testServer.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, testServer.URL+"/post", bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Encoding", tt.encoding)
+
+			resp, err := httpClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			if tt.wantStatus == http.StatusUnsupportedMediaType {
+				require.Equal(t, "gzip, deflate, br, zstd", resp.Header.Get("Accept-Encoding"))
+			}
+		})
+	}
+}
+
+func TestIdentityBody(t *testing.T) {
+	testServer := httptest.NewServer(NewRouter())
+	defer testServer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, testServer.URL+"/post", strings.NewReader("data"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "identity")
+
+	resp, err := httpClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	result := &MethodsResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	require.Equal(t, "data", result.Data)
+	require.Nil(t, result.RequestEncoding)
+}
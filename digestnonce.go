@@ -0,0 +1,114 @@
+package httpbulb
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDigestNonceTTL = 5 * time.Minute
+	// maxDigestNonces limits the number of kept nonces, every 401 response issues a new one
+	maxDigestNonces = 10000
+)
+
+var (
+	errNonceUnknown = errors.New("nonce was not issued by the server")
+	errNonceStale   = errors.New("nonce is expired")
+	errNonceOpaque  = errors.New("opaque does not match the nonce")
+	errNonceCount   = errors.New("nonce count is invalid or was already used")
+)
+
+type digestNonce struct {
+	opaque  string
+	expires time.Time
+	// nc is the last used nonce count
+	nc uint64
+}
+
+// DigestNonceStore keeps nonces issued by digest authentication challenges.
+// It is used by the strict mode of `/digest-auth` to check that a nonce was issued by the server,
+// that it is not expired, that opaque matches and that nonce count (`nc`) increases.
+//
+// A zero DigestNonceStore is usable, nonces are valid for 5 minutes.
+// The store keeps up to 10000 nonces, the oldest ones are dropped first.
+// It is guarded by a mutex, so it can be shared by concurrent requests.
+type DigestNonceStore struct {
+	ttl    time.Duration
+	mu     sync.Mutex
+	nonces map[string]*digestNonce
+	// order keeps nonces in the order they were issued, which is also the order they expire
+	order []string
+}
+
+// NewDigestNonceStore returns a new DigestNonceStore, nonces are valid for ttl (5 minutes by default).
+func NewDigestNonceStore(ttl time.Duration) *DigestNonceStore {
+	if ttl <= 0 {
+		ttl = defaultDigestNonceTTL
+	}
+	return &DigestNonceStore{ttl: ttl}
+}
+
+func (s *DigestNonceStore) nonceTTL() time.Duration {
+	if s.ttl <= 0 {
+		return defaultDigestNonceTTL
+	}
+	return s.ttl
+}
+
+// add stores the issued nonce with its opaque value.
+func (s *DigestNonceStore) add(nonce, opaque string) {
+	now := time.Now()
+	ttl := s.nonceTTL()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nonces == nil {
+		s.nonces = make(map[string]*digestNonce)
+	}
+	// only the oldest nonces are visited, so the sweep is cheap for every issued nonce
+	for len(s.order) > 0 {
+		oldest := s.order[0]
+		// expired nonces are kept for a while to answer with `stale=true`
+		if n, ok := s.nonces[oldest]; ok && !now.After(n.expires.Add(ttl)) && len(s.order) < maxDigestNonces {
+			break
+		}
+		delete(s.nonces, oldest)
+		s.order = s.order[1:]
+	}
+	s.nonces[nonce] = &digestNonce{opaque: opaque, expires: now.Add(ttl)}
+	s.order = append(s.order, nonce)
+}
+
+// check validates the nonce, opaque and nonce count (a hex number) of the request.
+// If the request has no nonce count, the nonce can be used only once.
+// The nonce count is not consumed if the nonce is stale.
+func (s *DigestNonceStore) check(nonce, opaque, nc string) error {
+	count := uint64(1)
+	if nc != "" {
+		var err error
+		if count, err = strconv.ParseUint(nc, 16, 64); err != nil {
+			return errNonceCount
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.nonces[nonce]
+	switch {
+	case !ok:
+		return errNonceUnknown
+	case subtle.ConstantTimeCompare([]byte(n.opaque), []byte(opaque)) != 1:
+		return errNonceOpaque
+	case time.Now().After(n.expires):
+		return errNonceStale
+	case count <= n.nc:
+		return errNonceCount
+	}
+	n.nc = count
+	return nil
+}
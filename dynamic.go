@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -32,7 +33,14 @@ func Base64DecodeHandle(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// StreamNMessagesHandle streams N json messages
+// StreamNMessagesHandle streams N json messages.
+// The number of messages is limited by the router configuration (`Config.StreamMaxMessages`).
+//
+// Query parameters:
+//   - `format` is one of `ndjson` (default), `json-seq` (RFC 7464) or `json-array`;
+//   - `interval` is a pause between messages, a duration (`250ms`) or a number of seconds (max 10s);
+//   - `padding` adds a `padding` field with the given number of bytes to each message (max 100KB);
+//   - `fail_after` aborts the stream after the given number of messages.
 func StreamNMessagesHandle(w http.ResponseWriter, r *http.Request) {
 	// Stream N messages
 	nParam := chi.URLParam(r, "n")
@@ -42,29 +50,101 @@ func StreamNMessagesHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	totalMessages = min(totalMessages, 100)
+	totalMessages = min(totalMessages, getConfig(r).StreamMaxMessages)
+
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	contentType, ok := streamContentTypes[format]
+	if !ok {
+		RenderError(w, "format: must be one of ndjson, json-seq, json-array", http.StatusBadRequest)
+		return
+	}
+
+	interval, err := parseInterval(query.Get("interval"))
+	if err != nil {
+		RenderError(w, "interval: bad parameter", http.StatusBadRequest)
+		return
+	}
+	interval = min(interval, 10*time.Second)
+
+	var padding int
+	if paddingParam := query.Get("padding"); paddingParam != "" {
+		if padding, err = strconv.Atoi(paddingParam); err != nil || padding < 0 {
+			RenderError(w, "padding: bad parameter", http.StatusBadRequest)
+			return
+		}
+		padding = min(padding, 100*1024)
+	}
+
+	failAfter := -1
+	if failAfterParam := query.Get("fail_after"); failAfterParam != "" {
+		if failAfter, err = strconv.Atoi(failAfterParam); err != nil || failAfter < 0 {
+			RenderError(w, "fail_after: bad parameter", http.StatusBadRequest)
+			return
+		}
+	}
 
 	resp := &StreamResponse{
-		Args:    r.URL.Query(),
-		Headers: r.Header,
-		Origin:  getIP(r),
-		URL:     getAbsoluteURL(r),
+		Args:     query,
+		ArgsList: getArgsList(r.URL),
+		RawQuery: r.URL.RawQuery,
+		Headers:  r.Header,
+		Origin:   getIP(r),
+		URL:      getAbsoluteURL(r),
+		Padding:  strings.Repeat("*", padding),
 	}
 
-	flusher := w.(http.Flusher)
+	rc := http.NewResponseController(w)
 
-	w.Header().Set("Transfer-Encoding", "chunked")
+	// Transfer-Encoding is not set explicitly: net/http uses chunked encoding for HTTP/1.1
+	// and DATA frames for HTTP/2 when the response is flushed without Content-Length.
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(http.StatusOK)
-	flusher.Flush()
+	rc.Flush()
 
-	enc := json.NewEncoder(w)
+	if format == streamFormatJSONArray {
+		w.Write([]byte("["))
+	}
 
 	for i := 0; i < totalMessages; i++ {
+		if i == failAfter {
+			// abort the response: the connection (HTTP/1.x) or the stream (HTTP/2) is reset.
+			panic(http.ErrAbortHandler)
+		}
+
+		if i > 0 && interval > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+
 		resp.ID = i
-		enc.Encode(resp)
-		flusher.Flush()
+		msg, _ := json.Marshal(resp)
+
+		switch format {
+		case streamFormatJSONSeq:
+			w.Write([]byte{0x1e})
+		case streamFormatJSONArray:
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+		}
+		w.Write(msg)
+		if format != streamFormatJSONArray {
+			w.Write([]byte("\n"))
+		}
+		if err = rc.Flush(); err != nil {
+			return
+		}
 	}
 
+	if format == streamFormatJSONArray {
+		w.Write([]byte("]"))
+	}
 }
 
 // DelayHandle returns the same response as the MethodsHandle, but with a delay
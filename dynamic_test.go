@@ -2,6 +2,7 @@ package httpbulb
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -70,6 +71,140 @@ func (s *DynamicSuite) TestStream() {
 
 }
 
+func (s *DynamicSuite) TestStreamArgsList() {
+	resp, err := s.client.Get(s.testServer.URL + "/stream/1?z=1&a=2&z=3")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	result := &StreamResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+
+	s.Require().Equal("z=1&a=2&z=3", result.RawQuery)
+	s.Require().Equal([]QueryArg{
+		{Key: "z", Value: "1", Raw: "z=1"},
+		{Key: "a", Value: "2", Raw: "a=2"},
+		{Key: "z", Value: "3", Raw: "z=3"},
+	}, result.ArgsList)
+}
+
+func (s *DynamicSuite) TestStreamFormats() {
+	type testArgs struct {
+		name            string
+		query           string
+		wantContentType string
+		split           func(body []byte) [][]byte
+	}
+
+	splitLines := func(body []byte) [][]byte {
+		return bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+	}
+
+	tests := []testArgs{
+		{
+			name:            "ndjson",
+			query:           "format=ndjson",
+			wantContentType: "application/x-ndjson",
+			split:           splitLines,
+		},
+		{
+			name:            "json-seq",
+			query:           "format=json-seq&interval=10ms",
+			wantContentType: "application/json-seq",
+			split: func(body []byte) [][]byte {
+				require.Equal(s.T(), byte(0x1e), body[0])
+				var msgs [][]byte
+				for _, rec := range bytes.Split(body[1:], []byte{0x1e}) {
+					require.Equal(s.T(), byte('\n'), rec[len(rec)-1])
+					msgs = append(msgs, rec)
+				}
+				return msgs
+			},
+		},
+		{
+			name:            "json-array",
+			query:           "format=json-array&padding=64",
+			wantContentType: "application/json",
+			split: func(body []byte) [][]byte {
+				var msgs []json.RawMessage
+				require.NoError(s.T(), json.Unmarshal(body, &msgs))
+				var res [][]byte
+				for _, m := range msgs {
+					res = append(res, m)
+				}
+				return res
+			},
+		},
+	}
+
+	numMessages := 3
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			apiURL := fmt.Sprintf("%s/stream/%d?%s", s.testServer.URL, numMessages, tt.query)
+			resp, err := s.client.Get(apiURL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.wantContentType, resp.Header.Get("Content-Type"))
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			msgs := tt.split(body)
+			require.Len(t, msgs, numMessages)
+
+			for i, msg := range msgs {
+				result := new(StreamResponse)
+				require.NoError(t, json.Unmarshal(msg, result))
+				require.Equal(t, i, result.ID)
+				if strings.Contains(tt.query, "padding=64") {
+					require.Len(t, result.Padding, 64)
+				}
+			}
+		})
+	}
+}
+
+func (s *DynamicSuite) TestStreamBadParams() {
+	for _, query := range []string{"format=xml", "interval=abc", "padding=-1", "fail_after=x"} {
+		s.T().Run(query, func(t *testing.T) {
+			resp, err := s.client.Get(fmt.Sprintf("%s/stream/3?%s", s.testServer.URL, query))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func (s *DynamicSuite) TestStreamFailAfter() {
+	resp, err := s.client.Get(fmt.Sprintf("%s/stream/10?fail_after=2", s.testServer.URL))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	s.Require().Error(err)
+	s.Require().Len(bytes.Split(bytes.TrimSpace(body), []byte("\n")), 2)
+}
+
+func TestStreamHttp2(t *testing.T) {
+	testServer := httptest.NewUnstartedServer(NewRouterWithConfig(Config{StreamMaxMessages: 5}))
+	testServer.EnableHTTP2 = true
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	resp, err := testServer.Client().Get(testServer.URL + "/stream/10")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, "HTTP/2.0", resp.Proto)
+	require.Empty(t, resp.TransferEncoding)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	// the number of messages is limited by the router configuration
+	require.Len(t, bytes.Split(bytes.TrimSpace(body), []byte("\n")), 5)
+}
+
 func (s *DynamicSuite) TestDelay() {
 	d := 2
 
@@ -347,3 +482,26 @@ func (s *DynamicSuite) TestRange() {
 func TestDynamicSuite(t *testing.T) {
 	suite.Run(t, new(DynamicSuite))
 }
+
+func FuzzGetRequestRange(f *testing.F) {
+	f.Add("bytes=10-24", 30)
+	f.Add("bytes=-5", 30)
+	f.Add("bytes=5-", 30)
+	f.Add("bytes=0-100", 30)
+	f.Add("bytes=-0", 1)
+	f.Add("bytes=+1--2", 10)
+	f.Add("", 10)
+
+	f.Fuzz(func(t *testing.T, header string, upperBound int) {
+		if upperBound <= 0 {
+			t.Skip()
+		}
+		firstPos, lastPos := getRequestRange(header, upperBound)
+		if firstPos > lastPos {
+			// unsatisfiable range
+			return
+		}
+		require.GreaterOrEqual(t, firstPos, 0)
+		require.Less(t, lastPos, upperBound)
+	})
+}
@@ -10,6 +10,36 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+const (
+	streamFormatNDJSON    = "ndjson"
+	streamFormatJSONSeq   = "json-seq"
+	streamFormatJSONArray = "json-array"
+)
+
+var streamContentTypes = map[string]string{
+	"":                    "application/x-ndjson",
+	streamFormatNDJSON:    "application/x-ndjson",
+	streamFormatJSONSeq:   "application/json-seq",
+	streamFormatJSONArray: "application/json",
+}
+
+// parseInterval parses a duration given as a Go duration string (`250ms`, `1.5s`)
+// or as a number of seconds. Empty value means zero duration.
+func parseInterval(value string) (d time.Duration, err error) {
+	if value == "" {
+		return
+	}
+	if d, err = time.ParseDuration(value); err == nil {
+		return max(d, 0), nil
+	}
+	var seconds float64
+	if seconds, err = strconv.ParseFloat(value, 64); err != nil {
+		return
+	}
+	d = max(time.Duration(seconds*float64(time.Second)), 0)
+	return
+}
+
 func randomBytes(totalBytes int, rnd *rand.Rand) []byte {
 	var body []byte
 
@@ -87,7 +117,8 @@ func getRequestRange(rangeHeader string, upperBound int) (firstPos int, lastPos
 		lastPos = upperBound - 1
 	} else {
 		firstPos = *firstPosPtr
-		lastPos = *lastPosPtr
+		// a last position beyond the upper bound means the remainder (RFC 9110, section 14.1.2)
+		lastPos = min(*lastPosPtr, upperBound-1)
 	}
 
 	return
@@ -0,0 +1,282 @@
+package httpbulb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCServiceName is the full name of the gRPC service provided by `NewGRPCServer`.
+const GRPCServiceName = "httpbulb.Bulb"
+
+// grpcMaxStreamMessages limits the number of messages sent by the `ServerStream` method.
+const grpcMaxStreamMessages = 100
+
+// grpcServiceDesc describes the `httpbulb.Bulb` service.
+// There is no generated code for this service: messages are built with `dynamicpb`
+// from the descriptors in `grpcdesc.go`, so clients can discover them with the server reflection.
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: GRPCServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: grpcUnaryHandler("Echo", grpcEcho)},
+		{MethodName: "Status", Handler: grpcUnaryHandler("Status", grpcStatus)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ServerStream", Handler: grpcServerStream, ServerStreams: true},
+		{StreamName: "ClientStream", Handler: grpcClientStream, ClientStreams: true},
+		{StreamName: "BidiStream", Handler: grpcBidiStream, ServerStreams: true, ClientStreams: true},
+	},
+	Metadata: grpcProtoFile,
+}
+
+// NewGRPCServer returns a new grpc.Server with registered `httpbulb.Bulb` service
+// and the server reflection service.
+//
+// The service provides:
+//   - `Echo` returns the request message and payload along with the request metadata;
+//   - `ServerStream` sends `count` echo messages with `interval_ms` pause between them;
+//   - `ClientStream` receives messages and returns a single response with all of them joined;
+//   - `BidiStream` echoes every received message;
+//   - `Status` returns the given gRPC status code and message with `ErrorInfo` details,
+//     the request metadata is returned in headers and trailers.
+func NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&grpcServiceDesc, nil)
+	reflection.Register(s)
+	return s
+}
+
+// NewGRPCHandler returns a http.Handler that dispatches gRPC requests
+// (HTTP/2 requests with `application/grpc` content-type) to the grpcHandler,
+// all other requests are passed to the h handler.
+// It allows to serve `NewGRPCServer` and `NewRouter` on the same HTTP/2 server.
+func NewGRPCHandler(grpcHandler http.Handler, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func isGRPCRequest(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 && (ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+"))
+}
+
+type grpcMethodHandler = func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error)
+
+func grpcUnaryHandler(method string, fn func(context.Context, *dynamicpb.Message) (*dynamicpb.Message, error)) grpcMethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := grpcInputMessage(method)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return fn(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + GRPCServiceName + "/" + method,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return fn(ctx, req.(*dynamicpb.Message))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+func grpcInputMessage(method string) *dynamicpb.Message {
+	if method == "Status" {
+		return dynamicpb.NewMessage(grpcStatusRequestDesc)
+	}
+	return dynamicpb.NewMessage(grpcEchoRequestDesc)
+}
+
+func grpcEcho(ctx context.Context, in *dynamicpb.Message) (*dynamicpb.Message, error) {
+	return newGRPCEchoResponse(ctx, in, 0), nil
+}
+
+// grpcCodeNames are the canonical names of gRPC status codes, the index is the status code.
+var grpcCodeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+func grpcStatus(ctx context.Context, in *dynamicpb.Message) (*dynamicpb.Message, error) {
+	code := codes.Code(in.Get(grpcField(in, "code")).Int())
+	msg := in.Get(grpcField(in, "message")).String()
+	reason := in.Get(grpcField(in, "reason")).String()
+
+	if code > codes.Unauthenticated {
+		return nil, status.Errorf(codes.InvalidArgument, "code: must be between 0 and 16, got %d", code)
+	}
+
+	md := grpcEchoMetadata(ctx)
+	grpc.SetHeader(ctx, md)
+	grpc.SetTrailer(ctx, md)
+
+	if code == codes.OK {
+		return newGRPCEchoResponse(ctx, in, 0), nil
+	}
+
+	if reason == "" {
+		reason = grpcCodeNames[code]
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   "httpbulb",
+		Metadata: make(map[string]string),
+	}
+	for k, v := range md {
+		info.Metadata[k] = strings.Join(v, ", ")
+	}
+
+	st, err := status.New(code, msg).WithDetails(info)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return nil, st.Err()
+}
+
+func grpcServerStream(_ interface{}, stream grpc.ServerStream) error {
+	in := dynamicpb.NewMessage(grpcEchoRequestDesc)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+
+	count := int(in.Get(grpcField(in, "count")).Int())
+	count = min(max(1, count), grpcMaxStreamMessages)
+	interval := time.Duration(in.Get(grpcField(in, "interval_ms")).Int()) * time.Millisecond
+
+	for i := 0; i < count; i++ {
+		if i > 0 && interval > 0 {
+			select {
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			case <-time.After(interval):
+			}
+		}
+		if err := stream.SendMsg(newGRPCEchoResponse(stream.Context(), in, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func grpcClientStream(_ interface{}, stream grpc.ServerStream) error {
+	var messages []string
+	var payload []byte
+
+	for {
+		in := dynamicpb.NewMessage(grpcEchoRequestDesc)
+		err := stream.RecvMsg(in)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		messages = append(messages, in.Get(grpcField(in, "message")).String())
+		payload = append(payload, in.Get(grpcField(in, "payload")).Bytes()...)
+	}
+
+	in := dynamicpb.NewMessage(grpcEchoRequestDesc)
+	in.Set(grpcField(in, "message"), protoreflect.ValueOfString(strings.Join(messages, "\n")))
+	in.Set(grpcField(in, "payload"), protoreflect.ValueOfBytes(payload))
+
+	// for the client stream `index` is the number of received messages
+	return stream.SendMsg(newGRPCEchoResponse(stream.Context(), in, len(messages)))
+}
+
+func grpcBidiStream(_ interface{}, stream grpc.ServerStream) error {
+	for i := 0; ; i++ {
+		in := dynamicpb.NewMessage(grpcEchoRequestDesc)
+		err := stream.RecvMsg(in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.SendMsg(newGRPCEchoResponse(stream.Context(), in, i)); err != nil {
+			return err
+		}
+	}
+}
+
+func newGRPCEchoResponse(ctx context.Context, in *dynamicpb.Message, index int) *dynamicpb.Message {
+	out := dynamicpb.NewMessage(grpcEchoResponseDesc)
+
+	if fd := in.Descriptor().Fields().ByName("message"); fd != nil {
+		out.Set(grpcField(out, "message"), in.Get(fd))
+	}
+	if fd := in.Descriptor().Fields().ByName("payload"); fd != nil {
+		out.Set(grpcField(out, "payload"), in.Get(fd))
+	}
+	out.Set(grpcField(out, "index"), protoreflect.ValueOfInt32(int32(index)))
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		out.Set(grpcField(out, "peer"), protoreflect.ValueOfString(p.Addr.String()))
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := out.Mutable(grpcField(out, "metadata")).List()
+	for _, k := range keys {
+		entry := list.NewElement()
+		values := entry.Message().Mutable(grpcMetadataEntryDesc.Fields().ByName("values")).List()
+		for _, v := range md[k] {
+			values.Append(protoreflect.ValueOfString(v))
+		}
+		entry.Message().Set(grpcMetadataEntryDesc.Fields().ByName("key"), protoreflect.ValueOfString(k))
+		list.Append(entry)
+	}
+	return out
+}
+
+// grpcEchoMetadata returns the incoming metadata without reserved and transport keys,
+// so it can be sent back to the client.
+func grpcEchoMetadata(ctx context.Context) metadata.MD {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	md := metadata.MD{}
+	for k, v := range incoming {
+		switch {
+		case strings.HasPrefix(k, ":"), strings.HasPrefix(k, "grpc-"):
+			continue
+		case k == "content-type", k == "user-agent", k == "te":
+			continue
+		}
+		md[k] = v
+	}
+	return md
+}
+
+func grpcField(m *dynamicpb.Message, name protoreflect.Name) protoreflect.FieldDescriptor {
+	return m.Descriptor().Fields().ByName(name)
+}
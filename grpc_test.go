@@ -0,0 +1,276 @@
+package httpbulb
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type GRPCSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	conn       *grpc.ClientConn
+}
+
+func (s *GRPCSuite) SetupSuite() {
+	handler := NewGRPCHandler(NewGRPCServer(), NewRouter())
+	s.testServer = httptest.NewUnstartedServer(handler)
+	s.testServer.EnableHTTP2 = true
+	s.testServer.StartTLS()
+
+	addr := strings.TrimPrefix(s.testServer.URL, "https://")
+	creds := credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	s.Require().NoError(err)
+	s.conn = conn
+}
+
+func (s *GRPCSuite) TearDownSuite() {
+	s.conn.Close()
+	s.testServer.Close()
+}
+
+func newTestEchoRequest(message string, count int) *dynamicpb.Message {
+	in := dynamicpb.NewMessage(grpcEchoRequestDesc)
+	in.Set(grpcField(in, "message"), protoreflect.ValueOfString(message))
+	in.Set(grpcField(in, "payload"), protoreflect.ValueOfBytes([]byte{0, 1, 2}))
+	in.Set(grpcField(in, "count"), protoreflect.ValueOfInt32(int32(count)))
+	return in
+}
+
+func echoResponseMessage(m *dynamicpb.Message) string {
+	return m.Get(grpcField(m, "message")).String()
+}
+
+func echoResponseIndex(m *dynamicpb.Message) int {
+	return int(m.Get(grpcField(m, "index")).Int())
+}
+
+func (s *GRPCSuite) TestEcho() {
+	t := s.T()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-test", "value")
+
+	out := dynamicpb.NewMessage(grpcEchoResponseDesc)
+	err := s.conn.Invoke(ctx, "/httpbulb.Bulb/Echo", newTestEchoRequest("hello", 0), out)
+	require.NoError(t, err)
+
+	require.Equal(t, "hello", echoResponseMessage(out))
+	require.Equal(t, []byte{0, 1, 2}, out.Get(grpcField(out, "payload")).Bytes())
+	require.NotEmpty(t, out.Get(grpcField(out, "peer")).String())
+
+	md := make(map[string][]string)
+	list := out.Get(grpcField(out, "metadata")).List()
+	for i := 0; i < list.Len(); i++ {
+		entry := list.Get(i).Message()
+		key := entry.Get(grpcMetadataEntryDesc.Fields().ByName("key")).String()
+		values := entry.Get(grpcMetadataEntryDesc.Fields().ByName("values")).List()
+		for j := 0; j < values.Len(); j++ {
+			md[key] = append(md[key], values.Get(j).String())
+		}
+	}
+	require.Equal(t, []string{"value"}, md["x-test"])
+}
+
+func (s *GRPCSuite) TestServerStream() {
+	t := s.T()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	desc := &grpc.StreamDesc{StreamName: "ServerStream", ServerStreams: true}
+	stream, err := s.conn.NewStream(ctx, desc, "/httpbulb.Bulb/ServerStream")
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(newTestEchoRequest("hello", 3)))
+	require.NoError(t, stream.CloseSend())
+
+	var indexes []int
+	for {
+		out := dynamicpb.NewMessage(grpcEchoResponseDesc)
+		err := stream.RecvMsg(out)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, "hello", echoResponseMessage(out))
+		indexes = append(indexes, echoResponseIndex(out))
+	}
+	require.Equal(t, []int{0, 1, 2}, indexes)
+}
+
+func (s *GRPCSuite) TestClientStream() {
+	t := s.T()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	desc := &grpc.StreamDesc{StreamName: "ClientStream", ClientStreams: true}
+	stream, err := s.conn.NewStream(ctx, desc, "/httpbulb.Bulb/ClientStream")
+	require.NoError(t, err)
+
+	for _, msg := range []string{"a", "b", "c"} {
+		require.NoError(t, stream.SendMsg(newTestEchoRequest(msg, 0)))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	out := dynamicpb.NewMessage(grpcEchoResponseDesc)
+	require.NoError(t, stream.RecvMsg(out))
+	require.Equal(t, "a\nb\nc", echoResponseMessage(out))
+	require.Equal(t, 3, echoResponseIndex(out))
+}
+
+func (s *GRPCSuite) TestBidiStream() {
+	t := s.T()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	desc := &grpc.StreamDesc{StreamName: "BidiStream", ClientStreams: true, ServerStreams: true}
+	stream, err := s.conn.NewStream(ctx, desc, "/httpbulb.Bulb/BidiStream")
+	require.NoError(t, err)
+
+	for i, msg := range []string{"a", "b"} {
+		require.NoError(t, stream.SendMsg(newTestEchoRequest(msg, 0)))
+		out := dynamicpb.NewMessage(grpcEchoResponseDesc)
+		require.NoError(t, stream.RecvMsg(out))
+		require.Equal(t, msg, echoResponseMessage(out))
+		require.Equal(t, i, echoResponseIndex(out))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	err = stream.RecvMsg(dynamicpb.NewMessage(grpcEchoResponseDesc))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func (s *GRPCSuite) TestStatus() {
+	type testArgs struct {
+		name       string
+		code       int32
+		message    string
+		reason     string
+		wantCode   codes.Code
+		wantReason string
+	}
+
+	tests := []testArgs{
+		{name: "OK", code: 0, wantCode: codes.OK},
+		{name: "NotFound", code: 5, message: "not found", wantCode: codes.NotFound, wantReason: "NOT_FOUND"},
+		{name: "InvalidArgument", code: 3, message: "bad", wantCode: codes.InvalidArgument, wantReason: "INVALID_ARGUMENT"},
+		{name: "Custom reason", code: 14, message: "try later", reason: "MAINTENANCE",
+			wantCode: codes.Unavailable, wantReason: "MAINTENANCE"},
+		{name: "Invalid code", code: 17, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-test", "value")
+
+			in := dynamicpb.NewMessage(grpcStatusRequestDesc)
+			in.Set(grpcField(in, "code"), protoreflect.ValueOfInt32(tt.code))
+			in.Set(grpcField(in, "message"), protoreflect.ValueOfString(tt.message))
+			in.Set(grpcField(in, "reason"), protoreflect.ValueOfString(tt.reason))
+
+			var header, trailer metadata.MD
+			out := dynamicpb.NewMessage(grpcEchoResponseDesc)
+			err := s.conn.Invoke(ctx, "/httpbulb.Bulb/Status", in, out,
+				grpc.Header(&header), grpc.Trailer(&trailer))
+
+			st := status.Convert(err)
+			require.Equal(t, tt.wantCode, st.Code())
+
+			if tt.wantCode == codes.InvalidArgument {
+				return
+			}
+
+			require.Equal(t, []string{"value"}, header.Get("x-test"))
+			require.Equal(t, []string{"value"}, trailer.Get("x-test"))
+
+			if tt.wantCode == codes.OK {
+				return
+			}
+
+			require.Equal(t, tt.message, st.Message())
+			require.Len(t, st.Details(), 1)
+			info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+			require.True(t, ok)
+			require.Equal(t, tt.wantReason, info.Reason)
+			require.Equal(t, "value", info.Metadata["x-test"])
+		})
+	}
+}
+
+func (s *GRPCSuite) TestReflection() {
+	t := s.T()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := reflectionpb.NewServerReflectionClient(s.conn)
+	stream, err := client.ServerReflectionInfo(ctx)
+	require.NoError(t, err)
+
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	require.NoError(t, err)
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+
+	var services []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		services = append(services, svc.GetName())
+	}
+	require.Contains(t, services, GRPCServiceName)
+
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: GRPCServiceName,
+		},
+	})
+	require.NoError(t, err)
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.GetFileDescriptorResponse().GetFileDescriptorProto())
+}
+
+func (s *GRPCSuite) TestHTTPDispatch() {
+	t := s.T()
+
+	resp, err := s.testServer.Client().Get(s.testServer.URL + "/get")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	result := new(MethodsResponse)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	require.Equal(t, "HTTP/2.0", result.Proto)
+}
+
+func TestGRPCSuite(t *testing.T) {
+	suite.Run(t, new(GRPCSuite))
+}
@@ -0,0 +1,152 @@
+package httpbulb
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// grpcProtoFile is the name of the proto file describing the `httpbulb.Bulb` service.
+// Its content is equivalent to:
+//
+//	syntax = "proto3";
+//	package httpbulb;
+//
+//	message EchoRequest {
+//	  string message = 1;
+//	  bytes payload = 2;
+//	  int32 count = 3;
+//	  int32 interval_ms = 4;
+//	}
+//
+//	message MetadataEntry {
+//	  string key = 1;
+//	  repeated string values = 2;
+//	}
+//
+//	message EchoResponse {
+//	  string message = 1;
+//	  bytes payload = 2;
+//	  repeated MetadataEntry metadata = 3;
+//	  int32 index = 4;
+//	  string peer = 5;
+//	}
+//
+//	message StatusRequest {
+//	  int32 code = 1;
+//	  string message = 2;
+//	  string reason = 3;
+//	}
+//
+//	service Bulb {
+//	  rpc Echo(EchoRequest) returns (EchoResponse);
+//	  rpc ServerStream(EchoRequest) returns (stream EchoResponse);
+//	  rpc ClientStream(stream EchoRequest) returns (EchoResponse);
+//	  rpc BidiStream(stream EchoRequest) returns (stream EchoResponse);
+//	  rpc Status(StatusRequest) returns (EchoResponse);
+//	}
+const grpcProtoFile = "httpbulb/bulb.proto"
+
+var (
+	grpcEchoRequestDesc   protoreflect.MessageDescriptor
+	grpcEchoResponseDesc  protoreflect.MessageDescriptor
+	grpcMetadataEntryDesc protoreflect.MessageDescriptor
+	grpcStatusRequestDesc protoreflect.MessageDescriptor
+)
+
+func init() {
+	fd, err := protodesc.NewFile(grpcFileDescriptorProto(), protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	// the file must be registered globally to be discoverable by the server reflection.
+	if err = protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		panic(err)
+	}
+
+	messages := fd.Messages()
+	grpcEchoRequestDesc = messages.ByName("EchoRequest")
+	grpcMetadataEntryDesc = messages.ByName("MetadataEntry")
+	grpcEchoResponseDesc = messages.ByName("EchoResponse")
+	grpcStatusRequestDesc = messages.ByName("StatusRequest")
+}
+
+func grpcFileDescriptorProto() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(grpcProtoFile),
+		Package: proto.String("httpbulb"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{
+			GoPackage: proto.String("github.com/niklak/httpbulb"),
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			grpcMessageProto("EchoRequest",
+				grpcFieldProto("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+				grpcFieldProto("payload", 2, descriptorpb.FieldDescriptorProto_TYPE_BYTES, false, ""),
+				grpcFieldProto("count", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, false, ""),
+				grpcFieldProto("interval_ms", 4, descriptorpb.FieldDescriptorProto_TYPE_INT32, false, ""),
+			),
+			grpcMessageProto("MetadataEntry",
+				grpcFieldProto("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+				grpcFieldProto("values", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, true, ""),
+			),
+			grpcMessageProto("EchoResponse",
+				grpcFieldProto("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+				grpcFieldProto("payload", 2, descriptorpb.FieldDescriptorProto_TYPE_BYTES, false, ""),
+				grpcFieldProto("metadata", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, true, ".httpbulb.MetadataEntry"),
+				grpcFieldProto("index", 4, descriptorpb.FieldDescriptorProto_TYPE_INT32, false, ""),
+				grpcFieldProto("peer", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+			),
+			grpcMessageProto("StatusRequest",
+				grpcFieldProto("code", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32, false, ""),
+				grpcFieldProto("message", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+				grpcFieldProto("reason", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+			),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Bulb"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					grpcMethodProto("Echo", "EchoRequest", "EchoResponse", false, false),
+					grpcMethodProto("ServerStream", "EchoRequest", "EchoResponse", false, true),
+					grpcMethodProto("ClientStream", "EchoRequest", "EchoResponse", true, false),
+					grpcMethodProto("BidiStream", "EchoRequest", "EchoResponse", true, true),
+					grpcMethodProto("Status", "StatusRequest", "EchoResponse", false, false),
+				},
+			},
+		},
+	}
+}
+
+func grpcMessageProto(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+}
+
+func grpcFieldProto(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  label.Enum(),
+		Type:   typ.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+func grpcMethodProto(name, input, output string, clientStreaming, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:            proto.String(name),
+		InputType:       proto.String(".httpbulb." + input),
+		OutputType:      proto.String(".httpbulb." + output),
+		ClientStreaming: proto.Bool(clientStreaming),
+		ServerStreaming: proto.Bool(serverStreaming),
+	}
+}
@@ -0,0 +1,302 @@
+package httpbulb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// rpcMaxMessageSize limits the size of a single message in gRPC-Web and Connect requests.
+const rpcMaxMessageSize = 4 << 20
+
+const (
+	rpcStatusHeader  = "Bulb-Status"
+	rpcMessageHeader = "Bulb-Message"
+	rpcTrailerHeader = "Bulb-Trailer"
+)
+
+const (
+	envelopeFlagCompressed byte = 0x01
+	envelopeFlagEndStream  byte = 0x02
+	envelopeFlagTrailer    byte = 0x80
+)
+
+// connectCodeNames are the status code names used by the Connect protocol,
+// the index is the gRPC status code.
+var connectCodeNames = []string{
+	"ok", "canceled", "unknown", "invalid_argument", "deadline_exceeded", "not_found",
+	"already_exists", "permission_denied", "resource_exhausted", "failed_precondition",
+	"aborted", "out_of_range", "unimplemented", "internal", "unavailable", "data_loss",
+	"unauthenticated",
+}
+
+var errIncompleteEnvelope = errors.New("incomplete envelope")
+
+type rpcEnvelope struct {
+	flags   byte
+	payload []byte
+}
+
+// GRPCWebHandle echoes gRPC-Web requests.
+// It can be used as a base URL (`/grpc-web`) for any gRPC-Web client: the procedure name is ignored,
+// every received message is sent back as is, so the client can decode it with the same message type.
+// Both binary (`application/grpc-web`) and text (`application/grpc-web-text`) modes are supported.
+//
+// The request metadata is echoed in the response headers.
+// `Bulb-Status` (a code number or name) and `Bulb-Message` request headers set the returned status,
+// `Bulb-Trailer` (`key: value`) request headers add trailers to the response.
+func GRPCWebHandle(w http.ResponseWriter, r *http.Request) {
+	ct := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "application/grpc-web") {
+		RenderError(w, "content-type: expected application/grpc-web", http.StatusUnsupportedMediaType)
+		return
+	}
+	textMode := strings.HasPrefix(ct, "application/grpc-web-text")
+
+	code, message, err := parseRPCStatus(r.Header)
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	trailers, err := parseRPCTrailers(r.Header)
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if textMode {
+		var raw []byte
+		if raw, err = io.ReadAll(io.LimitReader(r.Body, rpcMaxMessageSize*2)); err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var decoded []byte
+		if decoded, err = decodeGRPCWebText(raw); err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = bytes.NewReader(decoded)
+	}
+
+	envelopes, err := readRPCEnvelopes(body)
+	if err != nil {
+		code, message = codes.InvalidArgument, err.Error()
+	}
+
+	for _, env := range envelopes {
+		if env.flags&envelopeFlagCompressed != 0 {
+			code, message = codes.Unimplemented, "compressed messages are not supported"
+			break
+		}
+	}
+
+	for k, vv := range rpcEchoMetadata(r.Header) {
+		w.Header()[k] = vv
+	}
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(http.StatusOK)
+
+	buf := new(bytes.Buffer)
+	if code == codes.OK {
+		for _, env := range envelopes {
+			if env.flags&envelopeFlagTrailer == 0 {
+				writeRPCEnvelope(buf, 0, env.payload)
+			}
+		}
+	}
+
+	trailers.Set("Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		trailers.Set("Grpc-Message", grpcPercentEncode(message))
+	}
+	writeRPCEnvelope(buf, envelopeFlagTrailer, encodeGRPCWebTrailers(trailers))
+
+	if textMode {
+		w.Write([]byte(base64.StdEncoding.EncodeToString(buf.Bytes())))
+		return
+	}
+	w.Write(buf.Bytes())
+}
+
+// parseRPCStatus extracts the status code and message requested by the client
+// with `Bulb-Status` and `Bulb-Message` headers.
+func parseRPCStatus(h http.Header) (code codes.Code, message string, err error) {
+	if value := h.Get(rpcStatusHeader); value != "" {
+		if code, err = parseRPCCode(value); err != nil {
+			return
+		}
+	}
+	message = h.Get(rpcMessageHeader)
+	if message == "" && code != codes.OK {
+		message = connectCodeNames[code]
+	}
+	return
+}
+
+// parseRPCCode parses a status code given as a number (`5`),
+// a gRPC name (`NOT_FOUND`, `NotFound`) or a Connect name (`not_found`).
+func parseRPCCode(value string) (codes.Code, error) {
+	if num, err := strconv.Atoi(value); err == nil {
+		if num < 0 || num >= len(connectCodeNames) {
+			return 0, fmt.Errorf("%s: code must be between 0 and 16", rpcStatusHeader)
+		}
+		return codes.Code(num), nil
+	}
+
+	name := strings.ToLower(strings.ReplaceAll(value, "_", ""))
+	if name == "cancelled" {
+		name = "canceled"
+	}
+	for i, codeName := range connectCodeNames {
+		if name == strings.ReplaceAll(codeName, "_", "") {
+			return codes.Code(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: unknown code %q", rpcStatusHeader, value)
+}
+
+// parseRPCTrailers returns trailers requested by the client with `Bulb-Trailer: key: value` headers.
+func parseRPCTrailers(h http.Header) (http.Header, error) {
+	trailers := http.Header{}
+	for _, v := range h.Values(rpcTrailerHeader) {
+		key, value, ok := strings.Cut(v, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s: expected `key: value`, got %q", rpcTrailerHeader, v)
+		}
+		trailers.Add(key, strings.TrimSpace(value))
+	}
+	return trailers, nil
+}
+
+// rpcEchoMetadata returns the request headers that can be considered as a custom metadata,
+// so they can be sent back to the client.
+func rpcEchoMetadata(h http.Header) http.Header {
+	md := http.Header{}
+	for k, vv := range h {
+		lower := strings.ToLower(k)
+		switch {
+		case strings.HasPrefix(lower, "grpc-"), strings.HasPrefix(lower, "connect-"),
+			strings.HasPrefix(lower, "accept"), strings.HasPrefix(lower, "content-"),
+			strings.HasPrefix(lower, "sec-"), strings.HasPrefix(lower, "bulb-"):
+			continue
+		}
+		switch lower {
+		case "host", "user-agent", "x-user-agent", "x-grpc-web", "te", "connection",
+			"origin", "referer", "cookie", "authorization", "keep-alive", "trailer":
+			continue
+		}
+		md[k] = vv
+	}
+	return md
+}
+
+func readRPCEnvelopes(r io.Reader) (envelopes []rpcEnvelope, err error) {
+	prefix := make([]byte, 5)
+	for {
+		if _, err = io.ReadFull(r, prefix); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			} else if errors.Is(err, io.ErrUnexpectedEOF) {
+				err = errIncompleteEnvelope
+			}
+			return
+		}
+		size := binary.BigEndian.Uint32(prefix[1:])
+		if size > rpcMaxMessageSize {
+			err = fmt.Errorf("message size %d exceeds the limit %d", size, rpcMaxMessageSize)
+			return
+		}
+		payload := make([]byte, size)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			err = errIncompleteEnvelope
+			return
+		}
+		envelopes = append(envelopes, rpcEnvelope{flags: prefix[0], payload: payload})
+	}
+}
+
+func writeRPCEnvelope(w io.Writer, flags byte, payload []byte) error {
+	prefix := make([]byte, 5)
+	prefix[0] = flags
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(payload)))
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// decodeGRPCWebText decodes the body of the `application/grpc-web-text` request.
+// The client may send several base64 chunks each with its own padding, so they are decoded one by one.
+func decodeGRPCWebText(raw []byte) ([]byte, error) {
+	s := strings.Map(func(r rune) rune {
+		switch r {
+		case '\r', '\n', ' ', '\t':
+			return -1
+		}
+		return r
+	}, string(raw))
+
+	var decoded []byte
+	for s != "" {
+		end := strings.IndexByte(s, '=')
+		if end < 0 {
+			end = len(s)
+		} else {
+			for end < len(s) && s[end] == '=' {
+				end++
+			}
+		}
+		chunk, err := base64.StdEncoding.DecodeString(s[:end])
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, chunk...)
+		s = s[end:]
+	}
+	return decoded, nil
+}
+
+// encodeGRPCWebTrailers encodes trailers as a HTTP/1 header block, as it required by gRPC-Web.
+func encodeGRPCWebTrailers(trailers http.Header) []byte {
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		for _, v := range trailers[k] {
+			fmt.Fprintf(buf, "%s: %s\r\n", strings.ToLower(textproto.CanonicalMIMEHeaderKey(k)), v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// grpcPercentEncode encodes the status message as it required for the `grpc-message` header.
+func grpcPercentEncode(s string) string {
+	buf := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			buf.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(buf, "%%%02X", c)
+	}
+	return buf.String()
+}
@@ -0,0 +1,222 @@
+package httpbulb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type GRPCWebSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	client     *http.Client
+}
+
+func (s *GRPCWebSuite) SetupSuite() {
+	s.testServer = httptest.NewServer(NewRouter())
+	s.client = http.DefaultClient
+}
+
+func (s *GRPCWebSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func parseGRPCWebTrailers(t *testing.T, payload []byte) http.Header {
+	trailers := http.Header{}
+	for _, line := range strings.Split(strings.TrimSpace(string(payload)), "\r\n") {
+		k, v, ok := strings.Cut(line, ": ")
+		require.True(t, ok)
+		trailers.Add(k, v)
+	}
+	return trailers
+}
+
+func (s *GRPCWebSuite) TestGRPCWeb() {
+	type testArgs struct {
+		name         string
+		contentType  string
+		headers      http.Header
+		wantMessages [][]byte
+		wantStatus   string
+		wantMessage  string
+		wantTrailers http.Header
+	}
+
+	messages := [][]byte{[]byte("\x0a\x05hello"), {0, 1, 2, 255}}
+
+	tests := []testArgs{
+		{
+			name:         "echo binary",
+			contentType:  "application/grpc-web+proto",
+			wantMessages: messages,
+			wantStatus:   "0",
+		},
+		{
+			name:         "echo text",
+			contentType:  "application/grpc-web-text",
+			wantMessages: messages,
+			wantStatus:   "0",
+		},
+		{
+			name:        "status with message and trailers",
+			contentType: "application/grpc-web",
+			headers: http.Header{
+				"Bulb-Status":  {"NOT_FOUND"},
+				"Bulb-Message": {"nothing is here"},
+				"Bulb-Trailer": {"x-trailer: value"},
+			},
+			wantStatus:   "5",
+			wantMessage:  "nothing is here",
+			wantTrailers: http.Header{"X-Trailer": {"value"}},
+		},
+		{
+			name:        "status with a default message",
+			contentType: "application/grpc-web-text+proto",
+			headers:     http.Header{"Bulb-Status": {"16"}},
+			wantStatus:  "16",
+			wantMessage: "unauthenticated",
+		},
+	}
+
+	apiURL := s.testServer.URL + "/grpc-web/test.Service/Method"
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			textMode := strings.HasPrefix(tt.contentType, "application/grpc-web-text")
+
+			body := new(bytes.Buffer)
+			for _, m := range messages {
+				envelope := new(bytes.Buffer)
+				writeRPCEnvelope(envelope, 0, m)
+				if textMode {
+					// every chunk is encoded separately, as browsers do
+					body.WriteString(base64.StdEncoding.EncodeToString(envelope.Bytes()))
+				} else {
+					body.Write(envelope.Bytes())
+				}
+			}
+
+			req, err := http.NewRequest(http.MethodPost, apiURL, body)
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header[k] = v
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Metadata", "echo")
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+			require.Equal(t, "echo", resp.Header.Get("X-Metadata"))
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			if textMode {
+				respBody, err = base64.StdEncoding.DecodeString(string(respBody))
+				require.NoError(t, err)
+			}
+
+			envelopes, err := readRPCEnvelopes(bytes.NewReader(respBody))
+			require.NoError(t, err)
+			require.Len(t, envelopes, len(tt.wantMessages)+1)
+
+			for i, m := range tt.wantMessages {
+				require.Equal(t, byte(0), envelopes[i].flags)
+				require.Equal(t, m, envelopes[i].payload)
+			}
+
+			last := envelopes[len(envelopes)-1]
+			require.Equal(t, envelopeFlagTrailer, last.flags)
+
+			trailers := parseGRPCWebTrailers(t, last.payload)
+			require.Equal(t, tt.wantStatus, trailers.Get("grpc-status"))
+
+			message, err := url.PathUnescape(trailers.Get("grpc-message"))
+			require.NoError(t, err)
+			require.Equal(t, tt.wantMessage, message)
+
+			for k := range tt.wantTrailers {
+				require.Equal(t, tt.wantTrailers.Get(k), trailers.Get(k))
+			}
+		})
+	}
+}
+
+func (s *GRPCWebSuite) TestGRPCWebBadRequest() {
+	type testArgs struct {
+		name           string
+		contentType    string
+		headers        http.Header
+		wantStatusCode int
+	}
+
+	tests := []testArgs{
+		{name: "wrong content-type", contentType: "application/json", wantStatusCode: http.StatusUnsupportedMediaType},
+		{name: "wrong status", contentType: "application/grpc-web",
+			headers: http.Header{"Bulb-Status": {"42"}}, wantStatusCode: http.StatusBadRequest},
+		{name: "wrong trailer", contentType: "application/grpc-web",
+			headers: http.Header{"Bulb-Trailer": {"no-value"}}, wantStatusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, s.testServer.URL+"/grpc-web/test.Service/Method", nil)
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header[k] = v
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestGRPCWebSuite(t *testing.T) {
+	suite.Run(t, new(GRPCWebSuite))
+}
+
+func Test_parseRPCCode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "5", want: 5},
+		{value: "NOT_FOUND", want: 5},
+		{value: "NotFound", want: 5},
+		{value: "not_found", want: 5},
+		{value: "CANCELLED", want: 1},
+		{value: "unauthenticated", want: 16},
+		{value: "17", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "whatever", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseRPCCode(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, int(got))
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package httpbulb
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	h2cModeUpgrade        = "upgrade"
+	h2cModePriorKnowledge = "prior-knowledge"
+)
+
+type h2cModeKey struct{}
+
+// NewH2CHandler wraps the handler (usually the router returned by `NewRouter`)
+// to serve cleartext HTTP/2 (h2c).
+// It handles both h2c with prior knowledge and the `Upgrade: h2c` mechanism,
+// all other requests are passed to the handler as is.
+func NewH2CHandler(h http.Handler) http.Handler {
+	h2cHandler := h2c.NewHandler(h, &http2.Server{})
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// the context of this request becomes the base context of the hijacked connection,
+		// so every HTTP/2 request on this connection will know how it was established.
+		if mode := detectH2CMode(r); mode != "" {
+			r = r.WithContext(context.WithValue(r.Context(), h2cModeKey{}, mode))
+		}
+		h2cHandler.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func detectH2CMode(r *http.Request) string {
+	if r.Method == "PRI" && r.URL.Path == "*" && r.Proto == "HTTP/2.0" {
+		return h2cModePriorKnowledge
+	}
+
+	if headerContainsToken(r.Header, "Upgrade", "h2c") &&
+		headerContainsToken(r.Header, "Connection", "HTTP2-Settings") {
+		return h2cModeUpgrade
+	}
+	return ""
+}
+
+func headerContainsToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getH2CMode returns how the cleartext HTTP/2 connection was established:
+// `upgrade`, `prior-knowledge`, or an empty string if it is not an h2c connection.
+// Note that the upgrade request itself is served over HTTP/2 (stream 1),
+// but it keeps its original HTTP/1.1 protocol version.
+func getH2CMode(r *http.Request) string {
+	mode, _ := r.Context().Value(h2cModeKey{}).(string)
+	return mode
+}
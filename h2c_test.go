@@ -0,0 +1,141 @@
+package httpbulb
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/http2"
+)
+
+type H2CSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+}
+
+func (s *H2CSuite) SetupSuite() {
+	s.testServer = httptest.NewServer(NewH2CHandler(NewRouter()))
+}
+
+func (s *H2CSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+type h2cServerResponse struct {
+	Proto string `json:"proto"`
+	H2C   string `json:"h2c"`
+}
+
+func (s *H2CSuite) TestPriorKnowledge() {
+	t := s.T()
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	resp, err := client.Get(s.testServer.URL + "/get")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	result := new(h2cServerResponse)
+	err = json.NewDecoder(resp.Body).Decode(result)
+	require.NoError(t, err)
+
+	require.Equal(t, "HTTP/2.0", result.Proto)
+	require.Equal(t, h2cModePriorKnowledge, result.H2C)
+}
+
+func (s *H2CSuite) TestUpgrade() {
+	t := s.T()
+
+	u, err := url.Parse(s.testServer.URL)
+	require.NoError(t, err)
+
+	conn, err := net.DialTimeout("tcp", u.Host, 10*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// an empty SETTINGS payload is a valid HTTP2-Settings value
+	fmt.Fprintf(conn, "GET /get HTTP/1.1\r\nHost: %s\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n", u.Host)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	_, err = io.WriteString(conn, http2.ClientPreface)
+	require.NoError(t, err)
+
+	framer := http2.NewFramer(conn, br)
+	require.NoError(t, framer.WriteSettings())
+
+	// the response to the upgrade request is sent on the stream 1
+	var body []byte
+	for {
+		frame, err := framer.ReadFrame()
+		require.NoError(t, err)
+
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				require.NoError(t, framer.WriteSettingsAck())
+			}
+		case *http2.DataFrame:
+			if f.StreamID != 1 {
+				continue
+			}
+			body = append(body, f.Data()...)
+			if f.StreamEnded() {
+				result := new(h2cServerResponse)
+				err = json.Unmarshal(body, result)
+				require.NoError(t, err)
+
+				// the upgrade request keeps its original protocol version
+				require.Equal(t, "HTTP/1.1", result.Proto)
+				require.Equal(t, h2cModeUpgrade, result.H2C)
+				return
+			}
+		}
+	}
+}
+
+func (s *H2CSuite) TestHttp1() {
+	t := s.T()
+
+	resp, err := http.Get(s.testServer.URL + "/get")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	result := new(h2cServerResponse)
+	err = json.NewDecoder(resp.Body).Decode(result)
+	require.NoError(t, err)
+
+	require.Equal(t, "HTTP/1.1", result.Proto)
+	require.Empty(t, result.H2C)
+}
+
+func TestH2CSuite(t *testing.T) {
+	suite.Run(t, new(H2CSuite))
+}
@@ -9,9 +9,18 @@ import (
 // NewRouter returns a new chi.Mux with predefined http handlers.
 // It also accepts chi middlewares.
 func NewRouter(middlewares ...func(http.Handler) http.Handler) *chi.Mux {
+	return NewRouterWithConfig(DefaultConfig(), middlewares...)
+}
+
+// NewRouterWithConfig returns a new chi.Mux with predefined http handlers configured by cfg.
+// It also accepts chi middlewares.
+func NewRouterWithConfig(cfg Config, middlewares ...func(http.Handler) http.Handler) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(middlewares...)
+	r.Use(withConfig(cfg.withDefaults()))
+	r.Use(captureRaw)
+	r.Use(trackConn)
 
 	r.Delete("/delete", MethodsHandle)
 	r.Get("/get", MethodsHandle)
@@ -22,6 +31,8 @@ func NewRouter(middlewares ...func(http.Handler) http.Handler) *chi.Mux {
 	r.Get("/headers", http.HandlerFunc(HeadersHandle))
 	r.Get("/ip", http.HandlerFunc(IpHandle))
 	r.Get("/user-agent", http.HandlerFunc(UserAgentHandle))
+	r.Handle("/raw", http.HandlerFunc(RawHandle))
+	r.Handle("/connection", http.HandlerFunc(ConnectionHandle))
 
 	r.Get("/robots.txt", http.HandlerFunc(RobotsHandle))
 	r.Get("/gzip", http.HandlerFunc(GzipHandle))
@@ -41,10 +52,47 @@ func NewRouter(middlewares ...func(http.Handler) http.Handler) *chi.Mux {
 	r.Get("/basic-auth/{user}/{passwd}", http.HandlerFunc(BasicAuthHandle))
 	r.Get("/hidden-basic-auth/{user}/{passwd}", http.HandlerFunc(HiddenBasicAuthHandle))
 	r.Get("/bearer", http.HandlerFunc(BearerAuthHandle))
+	r.Get("/api-key", http.HandlerFunc(APIKeyHandle))
+	r.Get("/api-key/{key}", http.HandlerFunc(APIKeyExpectedHandle))
+	r.Handle("/proxy-auth/{user}/{passwd}", http.HandlerFunc(ProxyAuthHandle))
+	r.Get("/bearer/jwt", http.HandlerFunc(BearerJWTHandle))
+	r.Get("/.well-known/jwks.json", http.HandlerFunc(JWKSHandle))
+
+	r.Handle("/aws-sigv4", http.HandlerFunc(AWSSigV4Handle))
+	r.Handle("/aws-sigv4/*", http.HandlerFunc(AWSSigV4Handle))
+	r.Handle("/http-signature", http.HandlerFunc(HTTPSignatureHandle))
+	r.Handle("/http-signature/*", http.HandlerFunc(HTTPSignatureHandle))
+
+	r.Get("/login", http.HandlerFunc(LoginFormHandle))
+	r.Post("/login", http.HandlerFunc(LoginHandle))
+	r.Post("/logout", http.HandlerFunc(LogoutHandle))
+	r.Get("/session", http.HandlerFunc(SessionHandle))
+	r.Get("/protected", http.HandlerFunc(ProtectedHandle))
+	r.Get("/protected/*", http.HandlerFunc(ProtectedHandle))
+
+	r.Get("/tls", http.HandlerFunc(TLSHandle))
+	r.Get("/tls/client-cert", http.HandlerFunc(TLSClientCertHandle))
+
+	r.Get("/.well-known/openid-configuration", http.HandlerFunc(OIDCDiscoveryHandle))
+	r.Get("/oauth/authorize", http.HandlerFunc(OAuthAuthorizeHandle))
+	r.Post("/oauth/token", http.HandlerFunc(OAuthTokenHandle))
+	r.Post("/oauth/device/code", http.HandlerFunc(OAuthDeviceCodeHandle))
+	r.Get("/oauth/device", http.HandlerFunc(OAuthDeviceVerifyHandle))
+	r.Get("/oauth/userinfo", http.HandlerFunc(OAuthUserinfoHandle))
+	r.Post("/oauth/userinfo", http.HandlerFunc(OAuthUserinfoHandle))
+	r.Post("/oauth/introspect", http.HandlerFunc(OAuthIntrospectHandle))
 
 	r.Get("/digest-auth/{qop}/{user}/{passwd}", http.HandlerFunc(DigestAuthHandle))
 	r.Get("/digest-auth/{qop}/{user}/{passwd}/{algorithm}", http.HandlerFunc(DigestAuthHandle))
 	r.Get("/digest-auth/{qop}/{user}/{passwd}/{algorithm}/{stale_after}", http.HandlerFunc(DigestAuthHandle))
+	// POST allows to test `auth-int` with a body
+	r.Post("/digest-auth/{qop}/{user}/{passwd}", http.HandlerFunc(DigestAuthHandle))
+	r.Post("/digest-auth/{qop}/{user}/{passwd}/{algorithm}", http.HandlerFunc(DigestAuthHandle))
+	r.Post("/digest-auth/{qop}/{user}/{passwd}/{algorithm}/{stale_after}", http.HandlerFunc(DigestAuthHandle))
+
+	r.Post("/grpc-web/*", http.HandlerFunc(GRPCWebHandle))
+	r.Get("/connect/*", http.HandlerFunc(ConnectHandle))
+	r.Post("/connect/*", http.HandlerFunc(ConnectHandle))
 
 	r.Get("/base64/{value}", http.HandlerFunc(Base64DecodeHandle))
 	r.Get("/stream/{n:[0-9]+}", http.HandlerFunc(StreamNMessagesHandle))
@@ -57,11 +105,20 @@ func NewRouter(middlewares ...func(http.Handler) http.Handler) *chi.Mux {
 	r.Get("/range/{numbytes:[0-9]+}", http.HandlerFunc(RangeHandle))
 	r.Handle("/delay/{delay:[0-9]+}", http.HandlerFunc(DelayHandle))
 
+	r.Get("/poll/{channel}", http.HandlerFunc(PollHandle))
+	r.Post("/poll/{channel}", http.HandlerFunc(PollPublishHandle))
+
 	r.Get("/cookies", http.HandlerFunc(CookiesHandle))
 	r.Get("/cookies-list", http.HandlerFunc(CookiesListHandle))
 	r.Get("/cookies/set", http.HandlerFunc(SetCookiesHandle))
 	r.Get("/cookies/set/{name}/{value}", http.HandlerFunc(SetCookieHandle))
+	r.Post("/cookies/set", http.HandlerFunc(SetCookiesHandle))
+	r.Get("/cookies/set-noredirect", http.HandlerFunc(SetCookiesNoRedirectHandle))
+	r.Post("/cookies/set-noredirect", http.HandlerFunc(SetCookiesNoRedirectHandle))
+	r.Get("/cookies/set-noredirect/{name}/{value}", http.HandlerFunc(SetCookieNoRedirectHandle))
 	r.Get("/cookies/delete", http.HandlerFunc(DeleteCookiesHandle))
+	r.Get("/cookies/signed/set", http.HandlerFunc(SetSignedCookiesHandle))
+	r.Get("/cookies/signed/verify", http.HandlerFunc(VerifySignedCookiesHandle))
 
 	r.Handle("/redirect-to", http.HandlerFunc(RedirectToHandle))
 	r.Get("/redirect/{n:[0-9]+}", http.HandlerFunc(RedirectHandle))
@@ -2,8 +2,11 @@ package httpbulb
 
 import (
 	"embed"
+	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -56,6 +59,26 @@ func getIP(r *http.Request) string {
 	return ip
 }
 
+// getArgsList returns the query parameters in the order they were sent, including duplicated keys.
+// Unlike `url.ParseQuery`, pairs which can't be unescaped are kept as is.
+func getArgsList(u *url.URL) []QueryArg {
+	args := []QueryArg{}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		args = append(args, QueryArg{Key: key, Value: value, Raw: pair})
+	}
+	return args
+}
+
 func getRequestHeader(r *http.Request) http.Header {
 	h := r.Header.Clone()
 	h.Set("Host", r.Host)
@@ -96,3 +119,51 @@ func getCookie(r *http.Request, name string) (cookieValue string) {
 	}
 	return
 }
+
+// percentEncode percent-encodes every byte except ASCII letters, digits and the bytes of safe.
+func percentEncode(s string, safe string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte(safe, c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// bodyError is an error of the request body with the response status code.
+type bodyError struct {
+	status int
+	msg    string
+}
+
+func (e *bodyError) Error() string {
+	return e.msg
+}
+
+// readBodyLimit reads the whole body, which is needed to verify a signature or a hash.
+// A body larger than limit is not truncated, it is rejected with a 413 `bodyError`.
+func readBodyLimit(body io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &bodyError{status: http.StatusRequestEntityTooLarge,
+			msg: fmt.Sprintf("body exceeds %d bytes and can't be verified", limit)}
+	}
+	return data, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,362 @@
+package httpbulb
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP Message Signatures algorithms (RFC 9421, section 3.3).
+const (
+	HTTPSigHMACSHA256   = "hmac-sha256"
+	HTTPSigEd25519      = "ed25519"
+	HTTPSigRSAPSSSHA512 = "rsa-pss-sha512"
+)
+
+const (
+	// httpSigMaxSkew is the allowed clock difference for the `created` parameter.
+	httpSigMaxSkew = time.Minute
+	// httpSigMaxBodySize is the maximum size of the body checked against `Content-Digest`
+	httpSigMaxBodySize = 10 << 20
+)
+
+// HTTPSignatureKey is a key to verify HTTP Message Signatures (RFC 9421).
+type HTTPSignatureKey struct {
+	// ID is the key id, it is matched with `keyid` parameter of the signature.
+	ID string
+	// Key is one of: []byte (hmac-sha256), ed25519.PublicKey, ed25519.PrivateKey (ed25519),
+	// *rsa.PublicKey, *rsa.PrivateKey (rsa-pss-sha512).
+	Key interface{}
+}
+
+func (k HTTPSignatureKey) publicKey() crypto.PublicKey {
+	if signer, ok := k.Key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return k.Key
+}
+
+func (k HTTPSignatureKey) alg() string {
+	switch k.publicKey().(type) {
+	case []byte:
+		return HTTPSigHMACSHA256
+	case ed25519.PublicKey:
+		return HTTPSigEd25519
+	case *rsa.PublicKey:
+		return HTTPSigRSAPSSSHA512
+	}
+	return ""
+}
+
+// verify checks the signature of the signature base.
+func (k HTTPSignatureKey) verify(base, signature []byte) error {
+	var ok bool
+	switch key := k.publicKey().(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(base)
+		ok = subtle.ConstantTimeCompare(mac.Sum(nil), signature) == 1
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, base, signature)
+	case *rsa.PublicKey:
+		digest := sha512.Sum512(base)
+		ok = rsa.VerifyPSS(key, crypto.SHA512, digest[:], signature,
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil
+	default:
+		return errors.New("unsupported key type")
+	}
+	if !ok {
+		return errors.New("signature doesn't match")
+	}
+	return nil
+}
+
+// httpSignature is a signature from `Signature-Input` and `Signature` headers.
+type httpSignature struct {
+	label     string
+	input     sfItem
+	signature []byte
+}
+
+// parseHTTPSignatures returns the signatures of the request in the order of `Signature-Input` header.
+func parseHTTPSignatures(r *http.Request) (signatures []httpSignature, err error) {
+	inputs, err := parseSFDictionary(strings.Join(r.Header.Values("Signature-Input"), ", "))
+	if err != nil {
+		return nil, fmt.Errorf("Signature-Input: %w", err)
+	}
+	values, err := parseSFDictionary(strings.Join(r.Header.Values("Signature"), ", "))
+	if err != nil {
+		return nil, fmt.Errorf("Signature: %w", err)
+	}
+
+	for _, input := range inputs {
+		if _, ok := input.item.value.([]sfItem); !ok {
+			return nil, fmt.Errorf("Signature-Input: %q must be an inner list", input.name)
+		}
+		sig := httpSignature{label: input.name, input: input.item}
+		for _, v := range values {
+			if v.name == input.name {
+				var ok bool
+				if sig.signature, ok = v.item.value.([]byte); !ok {
+					return nil, fmt.Errorf("Signature: %q must be a byte sequence", input.name)
+				}
+			}
+		}
+		if sig.signature == nil {
+			return nil, fmt.Errorf("Signature: missing %q", input.name)
+		}
+		signatures = append(signatures, sig)
+	}
+	return
+}
+
+// signatureBase builds the signature base (RFC 9421, section 2.5) and returns the covered component names.
+func (s httpSignature) signatureBase(r *http.Request) (base string, components []string, err error) {
+	var b strings.Builder
+	seen := make(map[string]bool)
+	for _, component := range s.input.value.([]sfItem) {
+		name, ok := component.value.(string)
+		if !ok {
+			return "", nil, errors.New("component identifier must be a string")
+		}
+		var value string
+		if value, err = httpSigComponentValue(r, component); err != nil {
+			return "", nil, err
+		}
+		id := serializeSFItem(component)
+		if seen[id] {
+			return "", nil, fmt.Errorf("component %s is duplicated", id)
+		}
+		seen[id] = true
+		components = append(components, name)
+		b.WriteString(id)
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(serializeSFItem(s.input))
+	return b.String(), components, nil
+}
+
+// httpSigComponentValue returns the value of a derived component or a header field.
+func httpSigComponentValue(r *http.Request, component sfItem) (string, error) {
+	name := component.value.(string)
+	for _, p := range component.params {
+		if p.name != "name" || name != "@query-param" {
+			return "", fmt.Errorf("parameter %q of component %q is not supported", p.name, name)
+		}
+	}
+
+	switch name {
+	case "@method":
+		return r.Method, nil
+	case "@target-uri":
+		return getAbsoluteURL(r), nil
+	case "@authority":
+		return strings.ToLower(r.Host), nil
+	case "@scheme":
+		return getURLScheme(r), nil
+	case "@request-target":
+		return r.RequestURI, nil
+	case "@path":
+		if path := r.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	case "@query-param":
+		paramName, ok := component.param("name")
+		if !ok {
+			return "", errors.New(`"@query-param" requires "name" parameter`)
+		}
+		values := r.URL.Query()[fmt.Sprint(paramName)]
+		if len(values) != 1 {
+			return "", fmt.Errorf("query parameter %q must occur exactly once", paramName)
+		}
+		return httpSigQueryEscape(values[0]), nil
+	}
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("component %q is not supported", name)
+	}
+	if name != strings.ToLower(name) {
+		return "", fmt.Errorf("component %q must be lower-case", name)
+	}
+
+	var values []string
+	if name == "host" {
+		values = []string{r.Host}
+	} else {
+		values = r.Header.Values(name)
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("header %q is missing", name)
+	}
+	for i, value := range values {
+		values[i] = strings.TrimSpace(value)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// httpSigQueryEscape percent-encodes the value with the application/x-www-form-urlencoded percent-encode set.
+func httpSigQueryEscape(s string) string {
+	return percentEncode(s, "*-._")
+}
+
+// verify verifies the signature with one of the keys and fills the result.
+func (s httpSignature) verify(r *http.Request, keys []HTTPSignatureKey, now time.Time, result *HTTPSignatureResult) error {
+	if v, ok := s.input.param("keyid"); ok {
+		result.KeyID, _ = v.(string)
+	}
+	if v, ok := s.input.param("alg"); ok {
+		result.Algorithm, _ = v.(string)
+	}
+	if v, ok := s.input.param("created"); ok {
+		result.Created, _ = v.(int64)
+	}
+	if v, ok := s.input.param("expires"); ok {
+		result.Expires, _ = v.(int64)
+	}
+
+	var err error
+	if result.SignatureBase, result.Components, err = s.signatureBase(r); err != nil {
+		return err
+	}
+
+	if result.Created != 0 && time.Unix(result.Created, 0).After(now.Add(httpSigMaxSkew)) {
+		return errors.New("signature is created in the future")
+	}
+	if result.Expires != 0 && now.After(time.Unix(result.Expires, 0)) {
+		return errors.New("signature has expired")
+	}
+
+	if result.KeyID == "" {
+		return errors.New(`missing "keyid" parameter`)
+	}
+	var key *HTTPSignatureKey
+	for i := range keys {
+		if keys[i].ID == result.KeyID {
+			key = &keys[i]
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("unknown key %q", result.KeyID)
+	}
+	if result.Algorithm == "" {
+		result.Algorithm = key.alg()
+	} else if result.Algorithm != key.alg() {
+		return fmt.Errorf("algorithm %q doesn't match the key algorithm %q", result.Algorithm, key.alg())
+	}
+
+	return key.verify([]byte(result.SignatureBase), s.signature)
+}
+
+// checkContentDigest checks `Content-Digest` header (RFC 9530) against the body,
+// only sha-256 and sha-512 digests are checked.
+func checkContentDigest(r *http.Request) error {
+	header := strings.Join(r.Header.Values("Content-Digest"), ", ")
+	if header == "" {
+		return nil
+	}
+	digests, err := parseSFDictionary(header)
+	if err != nil {
+		return fmt.Errorf("Content-Digest: %w", err)
+	}
+	body, err := readBodyLimit(r.Body, httpSigMaxBodySize)
+	if err != nil {
+		return err
+	}
+	for _, d := range digests {
+		var computed []byte
+		switch d.name {
+		case "sha-256":
+			sum := sha256.Sum256(body)
+			computed = sum[:]
+		case "sha-512":
+			sum := sha512.Sum512(body)
+			computed = sum[:]
+		default:
+			continue
+		}
+		if value, ok := d.item.value.([]byte); !ok || subtle.ConstantTimeCompare(value, computed) != 1 {
+			return fmt.Errorf("Content-Digest %s doesn't match the body", d.name)
+		}
+	}
+	return nil
+}
+
+// HTTPSignatureHandle verifies HTTP Message Signatures (RFC 9421) of the request
+// with the keys from `Config.HTTPSignatureKeys`: hmac-sha256, ed25519 and rsa-pss-sha512.
+// The path after `/http-signature` and any query parameters can be covered by the signature.
+// `Content-Digest` header (sha-256, sha-512) is checked against the body.
+// If `label` query parameter is set, only the signature with this label is verified, otherwise all of them.
+//
+// It returns 401 if the request is not signed or a signature is not valid,
+// 400 if the signature headers are malformed.
+// The response contains the signature base computed by the server for every signature.
+func HTTPSignatureHandle(w http.ResponseWriter, r *http.Request) {
+	cfg := getConfig(r)
+
+	if len(r.Header.Values("Signature-Input")) == 0 {
+		RenderError(w, "request is not signed with HTTP Message Signatures", http.StatusUnauthorized)
+		return
+	}
+
+	signatures, err := parseHTTPSignatures(r)
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if label := r.URL.Query().Get("label"); label != "" {
+		var selected []httpSignature
+		for _, sig := range signatures {
+			if sig.label == label {
+				selected = append(selected, sig)
+			}
+		}
+		if len(selected) == 0 {
+			RenderError(w, fmt.Sprintf("signature %q is missing", label), http.StatusUnauthorized)
+			return
+		}
+		signatures = selected
+	}
+
+	status := http.StatusOK
+	resp := &HTTPSignatureResponse{Authenticated: true}
+	if err = checkContentDigest(r); err != nil {
+		resp.Authenticated = false
+		resp.Error = err.Error()
+		var bodyErr *bodyError
+		if errors.As(err, &bodyErr) {
+			status = bodyErr.status
+		}
+	}
+
+	now := time.Now()
+	for _, sig := range signatures {
+		result := HTTPSignatureResult{Label: sig.label}
+		if err := sig.verify(r, cfg.HTTPSignatureKeys, now, &result); err != nil {
+			result.Error = err.Error()
+			resp.Authenticated = false
+		} else {
+			result.Verified = true
+		}
+		resp.Signatures = append(resp.Signatures, result)
+	}
+
+	if !resp.Authenticated && status == http.StatusOK {
+		status = http.StatusUnauthorized
+	}
+	RenderResponse(w, status, resp)
+}
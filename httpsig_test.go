@@ -0,0 +1,289 @@
+package httpbulb
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// signHTTPMessage signs the request and sets `Signature-Input` and `Signature` headers.
+func signHTTPMessage(t *testing.T, r *http.Request, label, input string, key interface{}) {
+	members, err := parseSFDictionary(label + "=" + input)
+	require.NoError(t, err)
+	sig := httpSignature{label: label, input: members[0].item}
+
+	base, _, err := sig.signatureBase(r)
+	require.NoError(t, err)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(base))
+		signature = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(base))
+	case *rsa.PrivateKey:
+		digest := sha512.Sum512([]byte(base))
+		signature, err = rsa.SignPSS(rand.Reader, key, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+		require.NoError(t, err)
+	}
+
+	r.Header.Add("Signature-Input", label+"="+input)
+	r.Header.Add("Signature", label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+}
+
+func TestHTTPSignatureBaseEd25519(t *testing.T) {
+	// RFC 9421, appendix B.2.6
+	seed, err := base64.RawURLEncoding.DecodeString("n4Ni-HpISpVObnQMW0wOhCKROaIKqKtW_2ZYb2p9KcU")
+	require.NoError(t, err)
+	key := ed25519.NewKeyFromSeed(seed)
+
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	r.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Length", "18")
+
+	signHTTPMessage(t, r, "sig-b26",
+		`("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`,
+		key)
+	require.Equal(t, "sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:",
+		r.Header.Get("Signature"))
+}
+
+func TestParseSFDictionary(t *testing.T) {
+	members, err := parseSFDictionary(`sig1=("@method" "@query-param";name="Pet");created=1618884473;keyid="k\"1", ` +
+		`sig2=:dGVzdA==:, flag, tok=abc/def;q=?0;n=-5`)
+	require.NoError(t, err)
+	require.Len(t, members, 4)
+
+	require.Equal(t, "sig1", members[0].name)
+	require.Equal(t, `("@method" "@query-param";name="Pet");created=1618884473;keyid="k\"1"`, serializeSFItem(members[0].item))
+	require.Equal(t, []byte("test"), members[1].item.value)
+	require.Equal(t, true, members[2].item.value)
+	require.Equal(t, sfToken("abc/def"), members[3].item.value)
+	require.Equal(t, "abc/def;q=?0;n=-5", serializeSFItem(members[3].item))
+
+	for _, value := range []string{`a=(`, `a=1.5`, `A=1`, `a=:!!:`, `a=1,`, `a="x`, `a=?2`} {
+		_, err = parseSFDictionary(value)
+		require.ErrorIs(t, err, errStructuredField, value)
+	}
+}
+
+type HTTPSignatureSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	client     *http.Client
+	hmacKey    []byte
+	edKey      ed25519.PrivateKey
+	rsaKey     *rsa.PrivateKey
+}
+
+func (s *HTTPSignatureSuite) SetupSuite() {
+	var err error
+	s.hmacKey = []byte("bulb-secret")
+	_, s.edKey, err = ed25519.GenerateKey(rand.Reader)
+	s.Require().NoError(err)
+	s.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+
+	cfg := Config{
+		HTTPSignatureKeys: []HTTPSignatureKey{
+			{ID: "hmac-key", Key: s.hmacKey},
+			{ID: "ed-key", Key: s.edKey.Public()},
+			{ID: "rsa-key", Key: &s.rsaKey.PublicKey},
+		},
+	}
+	s.testServer = httptest.NewServer(NewRouterWithConfig(cfg))
+	s.client = http.DefaultClient
+}
+
+func (s *HTTPSignatureSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func (s *HTTPSignatureSuite) TestHTTPSignature() {
+	type signature struct {
+		label string
+		input string
+		key   interface{}
+	}
+
+	type testArgs struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		headers        map[string]string
+		signatures     []signature
+		modify         func(r *http.Request)
+		wantStatusCode int
+		wantError      string
+	}
+
+	created := strconv.FormatInt(time.Now().Unix(), 10)
+	components := `("@method" "@target-uri" "@authority" "@scheme" "@path" "@query" "content-type")`
+
+	tests := []testArgs{
+		{
+			name: "hmac-sha256", method: http.MethodGet, path: "/http-signature?a=1",
+			headers:        map[string]string{"Content-Type": "text/plain"},
+			signatures:     []signature{{"sig1", components + `;created=` + created + `;keyid="hmac-key";alg="hmac-sha256"`, s.hmacKey}},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "ed25519 with content digest", method: http.MethodPost, path: "/http-signature/echo",
+			body: `{"hello": "world"}`,
+			headers: map[string]string{
+				"Content-Type":   "application/json",
+				"Content-Digest": "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:",
+			},
+			signatures:     []signature{{"sig1", `("@method" "@path" "content-digest");keyid="ed-key"`, s.edKey}},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "rsa-pss-sha512 with query param", method: http.MethodGet, path: "/http-signature?pet=the%20dog&x=1",
+			signatures:     []signature{{"sig1", `("@method" "@query-param";name="pet");created=` + created + `;keyid="rsa-key"`, s.rsaKey}},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "several signatures", method: http.MethodGet, path: "/http-signature",
+			signatures: []signature{
+				{"sig1", `("@method");keyid="hmac-key"`, s.hmacKey},
+				{"sig2", `("@authority");keyid="ed-key"`, s.edKey},
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "too large body with content digest", method: http.MethodPost, path: "/http-signature",
+			body:           strings.Repeat("a", httpSigMaxBodySize+1),
+			headers:        map[string]string{"Content-Digest": "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"},
+			signatures:     []signature{{"sig1", `("@method");keyid="hmac-key"`, s.hmacKey}},
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "modified request", method: http.MethodGet, path: "/http-signature?a=1",
+			signatures: []signature{{"sig1", `("@method" "@query");keyid="hmac-key"`, s.hmacKey}},
+			modify: func(r *http.Request) {
+				r.URL.RawQuery = "a=2"
+			},
+			wantStatusCode: http.StatusUnauthorized, wantError: "signature doesn't match",
+		},
+		{
+			name: "modified body", method: http.MethodPost, path: "/http-signature", body: `{"hello": "moon"}`,
+			headers:        map[string]string{"Content-Digest": "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"},
+			signatures:     []signature{{"sig1", `("content-digest");keyid="ed-key"`, s.edKey}},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown key", method: http.MethodGet, path: "/http-signature",
+			signatures:     []signature{{"sig1", `("@method");keyid="unknown"`, s.hmacKey}},
+			wantStatusCode: http.StatusUnauthorized, wantError: "unknown key",
+		},
+		{
+			name: "algorithm mismatch", method: http.MethodGet, path: "/http-signature",
+			signatures:     []signature{{"sig1", `("@method");keyid="hmac-key";alg="ed25519"`, s.hmacKey}},
+			wantStatusCode: http.StatusUnauthorized, wantError: "doesn't match the key algorithm",
+		},
+		{
+			name: "expired", method: http.MethodGet, path: "/http-signature",
+			signatures:     []signature{{"sig1", `("@method");expires=1618884473;keyid="hmac-key"`, s.hmacKey}},
+			wantStatusCode: http.StatusUnauthorized, wantError: "expired",
+		},
+		{
+			name: "missing header", method: http.MethodGet, path: "/http-signature",
+			signatures: []signature{{"sig1", `("@method");keyid="hmac-key"`, s.hmacKey}},
+			modify: func(r *http.Request) {
+				r.Header.Set("Signature-Input", `sig1=("@method" "x-missing");keyid="hmac-key"`)
+			},
+			wantStatusCode: http.StatusUnauthorized, wantError: `header "x-missing" is missing`,
+		},
+		{
+			name: "missing signature", method: http.MethodGet, path: "/http-signature",
+			signatures: []signature{{"sig1", `("@method");keyid="hmac-key"`, s.hmacKey}},
+			modify: func(r *http.Request) {
+				r.Header.Del("Signature")
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "not signed", method: http.MethodGet, path: "/http-signature",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, s.testServer.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			for _, sig := range tt.signatures {
+				signHTTPMessage(t, req, sig.label, sig.input, sig.key)
+			}
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			if tt.wantStatusCode == http.StatusBadRequest || len(tt.signatures) == 0 {
+				return
+			}
+
+			result := &HTTPSignatureResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			require.Equal(t, tt.wantStatusCode == http.StatusOK, result.Authenticated)
+			require.Len(t, result.Signatures, len(tt.signatures))
+			for i, sig := range result.Signatures {
+				require.Equal(t, tt.signatures[i].label, sig.Label)
+				if sig.Verified {
+					require.True(t, strings.HasSuffix(sig.SignatureBase, `"@signature-params": `+tt.signatures[i].input))
+				}
+				if tt.wantError != "" {
+					require.Contains(t, sig.Error, tt.wantError)
+				}
+			}
+		})
+	}
+}
+
+func (s *HTTPSignatureSuite) TestLabel() {
+	req, err := http.NewRequest(http.MethodGet, s.testServer.URL+"/http-signature?label=good", nil)
+	s.Require().NoError(err)
+	signHTTPMessage(s.T(), req, "bad", `("@method");keyid="hmac-key"`, []byte("wrong"))
+	signHTTPMessage(s.T(), req, "good", `("@method");keyid="hmac-key"`, s.hmacKey)
+
+	resp, err := s.client.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	result := &HTTPSignatureResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	s.Require().Len(result.Signatures, 1)
+	s.Require().Equal("good", result.Signatures[0].Label)
+}
+
+func TestHTTPSignatureSuite(t *testing.T) {
+	suite.Run(t, new(HTTPSignatureSuite))
+}
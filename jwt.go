@@ -0,0 +1,340 @@
+package httpbulb
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	jwtAlgHS256 = "HS256"
+	jwtAlgRS256 = "RS256"
+	jwtAlgES256 = "ES256"
+)
+
+// JWTKey is an asymmetric key to verify (and, if it is a private key, to sign) JWTs.
+// Public parts of the keys are published in the JWKS (`/.well-known/jwks.json`).
+type JWTKey struct {
+	// ID is the key id, it is matched with `kid` header of the token.
+	ID string
+	// Key is one of: *rsa.PrivateKey, *rsa.PublicKey (RS256),
+	// *ecdsa.PrivateKey, *ecdsa.PublicKey with P-256 curve (ES256).
+	Key interface{}
+}
+
+func (k JWTKey) publicKey() crypto.PublicKey {
+	if signer, ok := k.Key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return k.Key
+}
+
+func (k JWTKey) alg() string {
+	switch k.publicKey().(type) {
+	case *rsa.PublicKey:
+		return jwtAlgRS256
+	case *ecdsa.PublicKey:
+		return jwtAlgES256
+	}
+	return ""
+}
+
+// JWK represents a public JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA public key parameters
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC public key parameters
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSResponse represents a JSON Web Key Set.
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+func newJWK(key JWTKey) (jwk JWK, ok bool) {
+	jwk = JWK{Kid: key.ID, Use: "sig", Alg: key.alg()}
+	switch pub := key.publicKey().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return
+		}
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32)))
+	default:
+		return
+	}
+	ok = true
+	return
+}
+
+type jwtToken struct {
+	header       map[string]interface{}
+	claims       map[string]interface{}
+	signingInput string
+	signature    []byte
+}
+
+func (t *jwtToken) alg() string {
+	alg, _ := t.header["alg"].(string)
+	return alg
+}
+
+func (t *jwtToken) kid() string {
+	kid, _ := t.header["kid"].(string)
+	return kid
+}
+
+func parseJWT(token string) (t *jwtToken, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		err = errors.New("token must consist of three parts")
+		return
+	}
+
+	t = &jwtToken{signingInput: parts[0] + "." + parts[1]}
+
+	if err = decodeJWTPart(parts[0], &t.header); err != nil {
+		err = fmt.Errorf("header: %w", err)
+		return
+	}
+	if err = decodeJWTPart(parts[1], &t.claims); err != nil {
+		err = fmt.Errorf("claims: %w", err)
+		return
+	}
+	if t.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		err = fmt.Errorf("signature: %w", err)
+	}
+	return
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature verifies the token signature with the HS256 secret or one of the asymmetric keys.
+func (t *jwtToken) verifySignature(secret []byte, keys []JWTKey) error {
+	alg := t.alg()
+
+	switch alg {
+	case jwtAlgHS256:
+		if len(secret) == 0 {
+			return errors.New("HS256 is not configured on the server")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(t.signingInput))
+		if subtle.ConstantTimeCompare(mac.Sum(nil), t.signature) != 1 {
+			return errors.New("signature is invalid")
+		}
+		return nil
+	case jwtAlgRS256, jwtAlgES256:
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	digest := sha256.Sum256([]byte(t.signingInput))
+	kid := t.kid()
+
+	var found bool
+	for _, key := range keys {
+		if key.alg() != alg || (kid != "" && key.ID != kid) {
+			continue
+		}
+		found = true
+
+		switch pub := key.publicKey().(type) {
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], t.signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if len(t.signature) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(t.signature[:32])
+			s := new(big.Int).SetBytes(t.signature[32:])
+			if ecdsa.Verify(pub, digest[:], r, s) {
+				return nil
+			}
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no %s key found for kid %q", alg, kid)
+	}
+	return errors.New("signature is invalid")
+}
+
+// verifyClaims checks time-based claims (`exp`, `nbf`) and, if given, `aud` and `iss`.
+func (t *jwtToken) verifyClaims(now time.Time, audience, issuer string) error {
+	if exp, ok := t.claims["exp"]; ok {
+		expTime, ok := jwtNumericDate(exp)
+		if !ok {
+			return errors.New("exp: must be a numeric date")
+		}
+		if !now.Before(expTime) {
+			return errors.New("token is expired")
+		}
+	}
+
+	if nbf, ok := t.claims["nbf"]; ok {
+		nbfTime, ok := jwtNumericDate(nbf)
+		if !ok {
+			return errors.New("nbf: must be a numeric date")
+		}
+		if now.Before(nbfTime) {
+			return errors.New("token is not valid yet")
+		}
+	}
+
+	if issuer != "" {
+		if iss, _ := t.claims["iss"].(string); iss != issuer {
+			return fmt.Errorf("iss: expected %q", issuer)
+		}
+	}
+
+	if audience != "" && !jwtContainsString(t.claims["aud"], audience) {
+		return fmt.Errorf("aud: expected %q", audience)
+	}
+	return nil
+}
+
+// missingScopes returns the required scopes which are absent in `scope` (space-delimited string)
+// or `scp` (a list of strings) claims.
+func (t *jwtToken) missingScopes(required []string) (missing []string) {
+	granted := make(map[string]bool)
+	if scope, ok := t.claims["scope"].(string); ok {
+		for _, s := range strings.Fields(scope) {
+			granted[s] = true
+		}
+	}
+	if scp, ok := t.claims["scp"].([]interface{}); ok {
+		for _, s := range scp {
+			if str, ok := s.(string); ok {
+				granted[str] = true
+			}
+		}
+	}
+
+	for _, s := range required {
+		if !granted[s] {
+			missing = append(missing, s)
+		}
+	}
+	return
+}
+
+func jwtNumericDate(v interface{}) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	nsec := int64((f - float64(sec)) * float64(time.Second))
+	return time.Unix(sec, nsec), true
+}
+
+func jwtContainsString(v interface{}, s string) bool {
+	switch value := v.(type) {
+	case string:
+		return value == s
+	case []interface{}:
+		for _, item := range value {
+			if item == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignJWT returns a signed compact JWT with the given claims.
+// key is a []byte secret for HS256, *rsa.PrivateKey for RS256 or *ecdsa.PrivateKey (P-256) for ES256.
+// If kid is not empty it is set in the token header.
+// It is useful to produce tokens for the `/bearer/jwt` endpoint.
+func SignJWT(key interface{}, kid string, claims map[string]interface{}) (string, error) {
+	var alg string
+	switch k := key.(type) {
+	case []byte:
+		alg = jwtAlgHS256
+	case *rsa.PrivateKey:
+		alg = jwtAlgRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", errors.New("only P-256 curve is supported")
+		}
+		alg = jwtAlgES256
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+
+	header := map[string]interface{}{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." +
+		base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	var signature []byte
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -1,22 +1,37 @@
 package httpbulb
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"sort"
 	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
 )
 
 func newMethodResponse(r *http.Request) (response MethodsResponse, err error) {
 
 	var body []byte
 	response = MethodsResponse{
-		Args:    r.URL.Query(),
-		Headers: getRequestHeader(r),
-		Origin:  getIP(r),
-		URL:     getAbsoluteURL(r),
-		Proto:   r.Proto,
+		Args:       r.URL.Query(),
+		ArgsList:   getArgsList(r.URL),
+		RawQuery:   r.URL.RawQuery,
+		Headers:    getRequestHeader(r),
+		Origin:     getIP(r),
+		URL:        getAbsoluteURL(r),
+		Proto:      r.Proto,
+		H2C:        getH2CMode(r),
+		Raw:        getRawRequest(r),
+		Connection: getConnectionInfo(r),
 	}
 
 	ct, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
@@ -28,27 +43,26 @@ func newMethodResponse(r *http.Request) (response MethodsResponse, err error) {
 		return
 	}
 
+	if response.RequestEncoding, err = decompressBody(r, getConfig(r).MaxDecompressedBodySize); err != nil {
+		return
+	}
+
 	switch ct {
 	case "multipart/form-data":
-		if err = r.ParseMultipartForm(64 << 20); err != nil {
+		cfg := getConfig(r)
+		if err = r.ParseMultipartForm(cfg.MultipartMaxMemory); err != nil {
 			return
 		}
 
 		if r.MultipartForm != nil && r.MultipartForm.File != nil {
-			files := make(map[string][]string)
+			files := make(map[string][]FileInfo)
 			for k, f := range r.MultipartForm.File {
 				for _, fileHeader := range f {
-					var file multipart.File
-
-					if file, err = fileHeader.Open(); err != nil {
-						return
-					}
-					var fBody []byte
-
-					if fBody, err = io.ReadAll(file); err != nil {
+					var info FileInfo
+					if info, err = newFileInfo(fileHeader, cfg.MultipartContentLimit); err != nil {
 						return
 					}
-					files[k] = append(files[k], string(fBody))
+					files[k] = append(files[k], info)
 				}
 			}
 			response.Files = files
@@ -70,18 +84,137 @@ func newMethodResponse(r *http.Request) (response MethodsResponse, err error) {
 		if err != nil {
 			return
 		}
-		response.Data = string(body)
+		response.Data = bodyData(body, r.Header.Get("Content-Type"))
+	}
+
+	return
+}
+
+// newFileInfo returns the metadata of the uploaded file,
+// the content is included as a data URL if the file size doesn't exceed contentLimit.
+func newFileInfo(fileHeader *multipart.FileHeader, contentLimit int64) (info FileInfo, err error) {
+	info = FileInfo{
+		Filename:    fileHeader.Filename,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		Size:        fileHeader.Size,
+		Headers:     fileHeader.Header,
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	var content bytes.Buffer
+	withContent := contentLimit >= 0 && fileHeader.Size <= contentLimit
+	if withContent {
+		_, err = io.Copy(io.MultiWriter(h, &content), file)
+	} else {
+		_, err = io.Copy(h, file)
 	}
+	if err != nil {
+		return
+	}
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
 
+	if withContent {
+		info.Content = dataURL(info.ContentType, content.Bytes())
+	}
 	return
 }
 
+// bodyData returns the text of the body decoded with the `charset` of contentType (UTF-8 by default),
+// bodies of binary media types and bodies, which can't be decoded, are returned as a data URL.
+func bodyData(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	charset := strings.ToLower(params["charset"])
+	if charset == "" && !isTextMediaType(mediaType) {
+		return dataURL(contentType, body)
+	}
+	if charset == "" || charset == "utf-8" || charset == "utf8" || charset == "us-ascii" {
+		if utf8.Valid(body) {
+			return string(body)
+		}
+		return dataURL(contentType, body)
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return dataURL(contentType, body)
+	}
+	text, err := enc.NewDecoder().Bytes(body)
+	if err != nil || !utf8.Valid(text) {
+		return dataURL(contentType, body)
+	}
+	return string(text)
+}
+
+// isTextMediaType reports whether the media type is textual, an empty media type is treated as text.
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case mediaType == "", strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/ecmascript",
+		"application/x-www-form-urlencoded", "application/x-ndjson", "application/yaml", "application/graphql":
+		return true
+	}
+	return false
+}
+
+// dataURL returns the content as a base64 data URL (RFC 2397) with the normalized media type of contentType,
+// the media type is `application/octet-stream` by default.
+// Parameters, which values must be quoted, can't be represented in the URL and are dropped.
+func dataURL(contentType string, content []byte) string {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if mime.FormatMediaType(mediaType, nil) == "" {
+		mediaType, params = "application/octet-stream", nil
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("data:")
+	b.WriteString(mime.FormatMediaType(mediaType, nil))
+	for _, k := range keys {
+		formatted := mime.FormatMediaType(mediaType, map[string]string{k: params[k]})
+		if formatted == "" || strings.Contains(formatted, `"`) {
+			continue
+		}
+		_, param, _ := strings.Cut(formatted, "; ")
+		b.WriteString(";" + param)
+	}
+	b.WriteString(";base64,")
+	b.WriteString(base64.StdEncoding.EncodeToString(content))
+	return b.String()
+}
+
 // MethodsHandle is the basic handler for the methods endpoint (GET, POST, PUT, PATCH, DELETE)
 func MethodsHandle(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
 	response, err := newMethodResponse(r)
+	var bodyErr *bodyError
+	if errors.As(err, &bodyErr) {
+		if bodyErr.status == http.StatusUnsupportedMediaType {
+			w.Header().Set("Accept-Encoding", strings.Join(requestEncodings, ", "))
+		}
+		RenderError(w, bodyErr.msg, bodyErr.status)
+		return
+	}
 	if err != nil {
 		RenderError(w, err.Error(), http.StatusInternalServerError)
 		return
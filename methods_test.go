@@ -2,13 +2,17 @@ package httpbulb
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"net/url"
 	"strings"
 	"testing"
@@ -85,6 +89,30 @@ func (s *MethodsSuite) TestGet() {
 	require.Equal(t, apiURL.Host, result.Headers.Get("Host"))
 
 }
+
+func (s *MethodsSuite) TestArgsList() {
+	rawQuery := "b=2&a=1&b=x%20y&c=x+y&empty=&flag&&bad=%zz&k%3D=v%26"
+
+	resp, err := s.client.Get(s.testServer.URL + "/get?" + rawQuery)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	result := &MethodsResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+
+	s.Require().Equal(rawQuery, result.RawQuery)
+	s.Require().Equal([]QueryArg{
+		{Key: "b", Value: "2", Raw: "b=2"},
+		{Key: "a", Value: "1", Raw: "a=1"},
+		{Key: "b", Value: "x y", Raw: "b=x%20y"},
+		{Key: "c", Value: "x y", Raw: "c=x+y"},
+		{Key: "empty", Value: "", Raw: "empty="},
+		{Key: "flag", Value: "", Raw: "flag"},
+		{Key: "bad", Value: "%zz", Raw: "bad=%zz"},
+		{Key: "k=", Value: "v&", Raw: "k%3D=v%26"},
+	}, result.ArgsList)
+}
+
 func (s *MethodsSuite) TestHttp2Client() {
 	type testArgs struct {
 		name          string
@@ -308,21 +336,31 @@ func (s *MethodsSuite) TestJSON() {
 func (s *MethodsSuite) TestPostMultipart() {
 
 	type serverResponse struct {
-		URL   string              `json:"url"`
-		Form  url.Values          `json:"form"`
-		Files map[string][]string `json:"files"`
+		URL   string                `json:"url"`
+		Form  url.Values            `json:"form"`
+		Files map[string][]FileInfo `json:"files"`
 	}
 
 	testURL := fmt.Sprintf("%s/post", s.testServer.URL)
 
 	t := s.T()
 
+	binaryContent := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe}
+
 	buf := new(bytes.Buffer)
 	w := multipart.NewWriter(buf)
 	part, err := w.CreateFormFile("file", "file.txt")
 	require.NoError(t, err)
 	_, err = part.Write([]byte("file content"))
 	require.NoError(t, err)
+	part, err = w.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="file"; filename="image.png"`},
+		"Content-Type":        {"image/png"},
+		"X-Part":              {"1"},
+	})
+	require.NoError(t, err)
+	_, err = part.Write(binaryContent)
+	require.NoError(t, err)
 	err = w.WriteField("k", "v")
 	require.NoError(t, err)
 	require.NoError(t, w.Close())
@@ -352,9 +390,126 @@ func (s *MethodsSuite) TestPostMultipart() {
 
 	require.Equal(t, expectedForm, result.Form)
 
-	expectedFiles := map[string][]string{"file": {"file content"}}
-	require.Equal(t, expectedFiles, result.Files)
+	require.Len(t, result.Files["file"], 2)
+
+	text := result.Files["file"][0]
+	require.Equal(t, "file.txt", text.Filename)
+	require.Equal(t, "application/octet-stream", text.ContentType)
+	require.Equal(t, int64(12), text.Size)
+	sum := sha256.Sum256([]byte("file content"))
+	require.Equal(t, hex.EncodeToString(sum[:]), text.SHA256)
+	require.Equal(t, "data:application/octet-stream;base64,ZmlsZSBjb250ZW50", text.Content)
+
+	image := result.Files["file"][1]
+	require.Equal(t, "image.png", image.Filename)
+	require.Equal(t, "image/png", image.ContentType)
+	require.Equal(t, int64(len(binaryContent)), image.Size)
+	require.Equal(t, []string{"1"}, image.Headers["X-Part"])
+	require.Equal(t, "data:image/png;base64,"+base64.StdEncoding.EncodeToString(binaryContent), image.Content)
+
+}
+
+func TestBodyData(t *testing.T) {
+	type testArgs struct {
+		name        string
+		body        []byte
+		contentType string
+		want        string
+	}
+
+	binary := []byte{0x08, 0x96, 0x01, 0xff}
 
+	tests := []testArgs{
+		{name: "empty", body: nil, contentType: "application/octet-stream", want: ""},
+		{name: "text without content type", body: []byte("hello"), want: "hello"},
+		{name: "plain text", body: []byte("привет"), contentType: "text/plain", want: "привет"},
+		{name: "json suffix", body: []byte(`{"a":1}`), contentType: "application/problem+json", want: `{"a":1}`},
+		{name: "latin-1", body: []byte{'c', 'a', 'f', 0xe9}, contentType: "text/plain; charset=ISO-8859-1", want: "café"},
+		{name: "shift_jis", body: []byte{0x93, 0xfa, 0x96, 0x7b}, contentType: "text/plain; charset=Shift_JIS", want: "日本"},
+		{name: "utf-16le", body: []byte{'h', 0, 'i', 0}, contentType: "text/plain; charset=utf-16le", want: "hi"},
+		{name: "invalid utf-8", body: []byte{'a', 0xff}, contentType: "text/plain; charset=utf-8",
+			want: "data:text/plain;charset=utf-8;base64,Yf8="},
+		{name: "unknown charset", body: []byte("hi"), contentType: "text/plain; charset=x-unknown",
+			want: "data:text/plain;charset=x-unknown;base64,aGk="},
+		{name: "quoted parameter", body: []byte("hi"), contentType: `Text/Plain; Charset="x-unknown"; name="a b"`,
+			want: "data:text/plain;charset=x-unknown;base64,aGk="},
+		{name: "binary media type", body: []byte("text"), contentType: "application/octet-stream",
+			want: "data:application/octet-stream;base64,dGV4dA=="},
+		{name: "protobuf", body: binary, contentType: "application/x-protobuf",
+			want: "data:application/x-protobuf;base64," + base64.StdEncoding.EncodeToString(binary)},
+		{name: "invalid content type", body: binary, contentType: "not a media type",
+			want: "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(binary)},
+		{name: "binary without content type", body: binary,
+			want: "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(binary)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, bodyData(tt.body, tt.contentType))
+		})
+	}
+}
+
+func (s *MethodsSuite) TestBinaryBody() {
+	body := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+
+	resp, err := s.client.Post(s.testServer.URL+"/post", "image/png", bytes.NewReader(body))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	result := &MethodsResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+
+	mediaType, encoded, found := strings.Cut(result.Data, ";base64,")
+	s.Require().True(found)
+	s.Require().Equal("data:image/png", mediaType)
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	s.Require().NoError(err)
+	s.Require().Equal(body, decoded)
+}
+
+func TestMultipartContentLimit(t *testing.T) {
+	type testArgs struct {
+		name        string
+		limit       int64
+		wantContent bool
+	}
+
+	tests := []testArgs{
+		{name: "under the limit", limit: 4, wantContent: true},
+		{name: "over the limit", limit: 3, wantContent: false},
+		{name: "disabled", limit: -1, wantContent: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a small memory limit stores the file on disk
+			cfg := Config{MultipartMaxMemory: 1, MultipartContentLimit: tt.limit}
+			testServer := httptest.NewServer(NewRouterWithConfig(cfg))
+			defer testServer.Close()
+
+			buf := new(bytes.Buffer)
+			w := multipart.NewWriter(buf)
+			part, err := w.CreateFormFile("file", "file.txt")
+			require.NoError(t, err)
+			_, err = part.Write([]byte("data"))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			resp, err := http.Post(testServer.URL+"/post", w.FormDataContentType(), buf)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			result := &MethodsResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			require.Len(t, result.Files["file"], 1)
+			file := result.Files["file"][0]
+			require.Equal(t, int64(4), file.Size)
+			require.NotEmpty(t, file.SHA256)
+			require.Equal(t, tt.wantContent, file.Content != "")
+		})
+	}
 }
 
 func (s *MethodsSuite) TestDelete() {
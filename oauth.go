@@ -0,0 +1,610 @@
+package httpbulb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	oauthGrantClientCredentials = "client_credentials"
+	oauthGrantAuthorizationCode = "authorization_code"
+	oauthGrantRefreshToken      = "refresh_token"
+	oauthGrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+
+	oauthCodeTTL           = 10 * time.Minute
+	oauthDefaultTokenTTL   = time.Hour
+	oauthDefaultSubject    = "httpbulb"
+	oauthDevicePollSeconds = 5
+)
+
+// OAuthProvider is a stub OAuth2 / OpenID Connect provider served under `/oauth` routes.
+// It auto-approves every authorization request and issues JWTs signed with its own key,
+// the key is published in the JWKS (`/.well-known/jwks.json`),
+// so the tokens are also accepted by the `/bearer/jwt` endpoint.
+//
+// The zero value is ready to use: a missing key is generated on the first use and empty
+// `Subject` and `TokenTTL` get their defaults. The provider is safe for concurrent requests,
+// but its exported fields must not be changed while it serves them.
+// Codes, device authorizations and refresh tokens are kept in memory until they are redeemed or expire.
+type OAuthProvider struct {
+	// Key is the private key used to sign tokens. If it is not set, an ES256 key is generated.
+	Key JWTKey
+	// Clients maps client IDs to their secrets. An empty secret means a public client.
+	// If Clients is empty, any client is accepted and secrets are not checked.
+	Clients map[string]string
+	// Subject is the user approving authorization requests, it can be overridden by `login_hint`.
+	// Default is "httpbulb".
+	Subject string
+	// TokenTTL is the lifetime of access and ID tokens. Default is one hour.
+	TokenTTL time.Duration
+
+	mu            sync.Mutex
+	codes         map[string]*oauthGrant
+	refreshTokens map[string]*oauthGrant
+	devices       map[string]*oauthGrant
+}
+
+// oauthGrant is the state of an authorization code, a refresh token or a device authorization.
+type oauthGrant struct {
+	clientID      string
+	subject       string
+	scope         string
+	nonce         string
+	redirectURI   string
+	codeChallenge string
+	method        string
+	userCode      string
+	approved      bool
+	expires       time.Time
+}
+
+// addGrant stores the grant under the key and removes expired grants of the same kind,
+// so codes and tokens which are never redeemed don't pile up. The caller must hold `p.mu`.
+func (p *OAuthProvider) addGrant(grants *map[string]*oauthGrant, key string, grant *oauthGrant) {
+	if *grants == nil {
+		*grants = make(map[string]*oauthGrant)
+	}
+	now := time.Now()
+	for k, g := range *grants {
+		if now.After(g.expires) {
+			delete(*grants, k)
+		}
+	}
+	(*grants)[key] = grant
+}
+
+// NewOAuthProvider returns a new OAuthProvider with a generated ES256 signing key.
+func NewOAuthProvider() *OAuthProvider {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &OAuthProvider{
+		Key:      JWTKey{ID: "httpbulb-oauth", Key: key},
+		Clients:  make(map[string]string),
+		Subject:  oauthDefaultSubject,
+		TokenTTL: oauthDefaultTokenTTL,
+	}
+}
+
+// authenticateClient checks the client credentials given with Basic authentication
+// or `client_id` and `client_secret` form values.
+func (p *OAuthProvider) authenticateClient(r *http.Request, requireSecret bool) (clientID string, ok bool) {
+	clientID, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		return
+	}
+
+	if len(p.Clients) == 0 {
+		ok = true
+		return
+	}
+
+	expected, found := p.Clients[clientID]
+	if !found {
+		return
+	}
+	if expected == "" && !requireSecret && secret == "" {
+		// a public client
+		ok = true
+		return
+	}
+	ok = expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(secret)) == 1
+	return
+}
+
+func (p *OAuthProvider) knownClient(clientID string) bool {
+	if len(p.Clients) == 0 {
+		return clientID != ""
+	}
+	_, ok := p.Clients[clientID]
+	return ok
+}
+
+// key returns the signing key, the key is generated on the first use if it is not set.
+func (p *OAuthProvider) key() JWTKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Key.Key == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		p.Key = JWTKey{ID: "httpbulb-oauth", Key: key}
+	}
+	return p.Key
+}
+
+func (p *OAuthProvider) subject() string {
+	if p.Subject == "" {
+		return oauthDefaultSubject
+	}
+	return p.Subject
+}
+
+func (p *OAuthProvider) tokenTTL() time.Duration {
+	if p.TokenTTL <= 0 {
+		return oauthDefaultTokenTTL
+	}
+	return p.TokenTTL
+}
+
+func (p *OAuthProvider) issueTokens(r *http.Request, grant *oauthGrant, withRefresh bool) (*OAuthTokenResponse, error) {
+	now := time.Now()
+	issuer := getIssuer(r)
+	key := p.key()
+
+	accessClaims := map[string]interface{}{
+		"iss":       issuer,
+		"sub":       grant.subject,
+		"aud":       grant.clientID,
+		"client_id": grant.clientID,
+		"iat":       now.Unix(),
+		"nbf":       now.Unix(),
+		"exp":       now.Add(p.tokenTTL()).Unix(),
+		"jti":       uuid.New().String(),
+	}
+	if grant.scope != "" {
+		accessClaims["scope"] = grant.scope
+	}
+
+	accessToken, err := SignJWT(key.Key, key.ID, accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.tokenTTL().Seconds()),
+		Scope:       grant.scope,
+	}
+
+	if containsField(grant.scope, "openid") {
+		idClaims := map[string]interface{}{
+			"iss":       issuer,
+			"sub":       grant.subject,
+			"aud":       grant.clientID,
+			"iat":       now.Unix(),
+			"exp":       now.Add(p.tokenTTL()).Unix(),
+			"auth_time": now.Unix(),
+		}
+		if grant.nonce != "" {
+			idClaims["nonce"] = grant.nonce
+		}
+		if resp.IDToken, err = SignJWT(key.Key, key.ID, idClaims); err != nil {
+			return nil, err
+		}
+	}
+
+	if withRefresh {
+		resp.RefreshToken = randomToken(32)
+		p.mu.Lock()
+		p.addGrant(&p.refreshTokens, resp.RefreshToken, &oauthGrant{
+			clientID: grant.clientID,
+			subject:  grant.subject,
+			scope:    grant.scope,
+			expires:  now.Add(24 * time.Hour),
+		})
+		p.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// verifyToken verifies a token issued by the provider and returns its claims.
+func (p *OAuthProvider) verifyToken(token string) (map[string]interface{}, error) {
+	jwt, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	if err = jwt.verifySignature(nil, []JWTKey{p.key()}); err != nil {
+		return nil, err
+	}
+	if err = jwt.verifyClaims(time.Now(), "", ""); err != nil {
+		return nil, err
+	}
+	return jwt.claims, nil
+}
+
+func getIssuer(r *http.Request) string {
+	return getURLScheme(r) + "://" + r.Host
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// randomUserCode returns a user code for the device flow in the `XXXX-XXXX` form,
+// it uses only consonants to be easy to type and to avoid words.
+func randomUserCode() string {
+	const alphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	b := make([]byte, 8)
+	rand.Read(b)
+	code := make([]byte, 0, 9)
+	for i, c := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, alphabet[int(c)%len(alphabet)])
+	}
+	return string(code)
+}
+
+func containsField(s, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+	if verifier == "" {
+		return false
+	}
+	var computed string
+	switch method {
+	case "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		computed = verifier
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func writeOAuthError(w http.ResponseWriter, code int, errCode, description string) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="httpbulb"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	RenderResponse(w, code, &OAuthErrorResponse{Error: errCode, ErrorDescription: description})
+}
+
+// OIDCDiscoveryHandle returns the OpenID Connect discovery document.
+func OIDCDiscoveryHandle(w http.ResponseWriter, r *http.Request) {
+	issuer := getIssuer(r)
+	RenderResponse(w, http.StatusOK, &OIDCDiscoveryResponse{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		JwksURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device/code",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{getConfig(r).OAuth.key().alg()},
+		ScopesSupported:                   []string{"openid", "profile", "email", "offline_access"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		GrantTypesSupported: []string{
+			oauthGrantAuthorizationCode, oauthGrantClientCredentials,
+			oauthGrantRefreshToken, oauthGrantDeviceCode,
+		},
+		CodeChallengeMethodsSupported: []string{"plain", "S256"},
+	})
+}
+
+// OAuthAuthorizeHandle auto-approves the authorization request
+// and redirects to `redirect_uri` with the authorization code.
+// The user is `OAuthProvider.Subject` or the `login_hint` query parameter.
+func OAuthAuthorizeHandle(w http.ResponseWriter, r *http.Request) {
+	p := getConfig(r).OAuth
+	query := r.URL.Query()
+
+	clientID := query.Get("client_id")
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "redirect_uri: must be an absolute URL")
+		return
+	}
+	if !p.knownClient(clientID) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "unknown client_id")
+		return
+	}
+
+	params := redirectURI.Query()
+	if state := query.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+
+	method := query.Get("code_challenge_method")
+	switch {
+	case query.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	case method != "" && method != "plain" && method != "S256":
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "code_challenge_method: must be plain or S256")
+	default:
+		subject := query.Get("login_hint")
+		if subject == "" {
+			subject = p.subject()
+		}
+		code := randomToken(24)
+
+		p.mu.Lock()
+		p.addGrant(&p.codes, code, &oauthGrant{
+			clientID:      clientID,
+			subject:       subject,
+			scope:         query.Get("scope"),
+			nonce:         query.Get("nonce"),
+			redirectURI:   query.Get("redirect_uri"),
+			codeChallenge: query.Get("code_challenge"),
+			method:        method,
+			expires:       time.Now().Add(oauthCodeTTL),
+		})
+		p.mu.Unlock()
+		params.Set("code", code)
+	}
+
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// OAuthTokenHandle is the token endpoint. It supports `client_credentials`, `authorization_code` (with PKCE),
+// `refresh_token` and `urn:ietf:params:oauth:grant-type:device_code` grant types.
+func OAuthTokenHandle(w http.ResponseWriter, r *http.Request) {
+	p := getConfig(r).OAuth
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	clientID, ok := p.authenticateClient(r, grantType == oauthGrantClientCredentials)
+	if !ok {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	var grant *oauthGrant
+	var withRefresh bool
+
+	switch grantType {
+	case oauthGrantClientCredentials:
+		grant = &oauthGrant{clientID: clientID, subject: clientID, scope: r.PostForm.Get("scope")}
+
+	case oauthGrantAuthorizationCode:
+		code := r.PostForm.Get("code")
+		p.mu.Lock()
+		grant = p.codes[code]
+		// the code can be used only once
+		delete(p.codes, code)
+		p.mu.Unlock()
+
+		switch {
+		case grant == nil || time.Now().After(grant.expires) || grant.clientID != clientID:
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code is invalid or expired")
+			return
+		case grant.redirectURI != r.PostForm.Get("redirect_uri"):
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+			return
+		case !verifyCodeChallenge(grant.codeChallenge, grant.method, r.PostForm.Get("code_verifier")):
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier is invalid")
+			return
+		}
+		withRefresh = true
+
+	case oauthGrantRefreshToken:
+		token := r.PostForm.Get("refresh_token")
+		p.mu.Lock()
+		grant = p.refreshTokens[token]
+		// refresh tokens are rotated
+		delete(p.refreshTokens, token)
+		p.mu.Unlock()
+
+		if grant == nil || time.Now().After(grant.expires) || grant.clientID != clientID {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh_token is invalid or expired")
+			return
+		}
+		withRefresh = true
+
+	case oauthGrantDeviceCode:
+		deviceCode := r.PostForm.Get("device_code")
+		p.mu.Lock()
+		grant = p.devices[deviceCode]
+		var approved bool
+		if grant != nil {
+			approved = grant.approved
+			if approved {
+				delete(p.devices, deviceCode)
+			}
+		}
+		p.mu.Unlock()
+
+		switch {
+		case grant == nil || grant.clientID != clientID:
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "device_code is invalid")
+			return
+		case time.Now().After(grant.expires):
+			writeOAuthError(w, http.StatusBadRequest, "expired_token", "device_code is expired")
+			return
+		case !approved:
+			writeOAuthError(w, http.StatusBadRequest, "authorization_pending", "")
+			return
+		}
+		withRefresh = true
+
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	resp, err := p.issueTokens(r, grant, withRefresh)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	RenderResponse(w, http.StatusOK, resp)
+}
+
+// OAuthDeviceCodeHandle is the device authorization endpoint (RFC 8628).
+// The returned user code is approved by visiting `verification_uri_complete`.
+func OAuthDeviceCodeHandle(w http.ResponseWriter, r *http.Request) {
+	p := getConfig(r).OAuth
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, ok := p.authenticateClient(r, false)
+	if !ok {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	deviceCode := randomToken(32)
+	userCode := randomUserCode()
+
+	subject := p.subject()
+
+	p.mu.Lock()
+	p.addGrant(&p.devices, deviceCode, &oauthGrant{
+		clientID: clientID,
+		subject:  subject,
+		scope:    r.PostForm.Get("scope"),
+		userCode: userCode,
+		expires:  time.Now().Add(oauthCodeTTL),
+	})
+	p.mu.Unlock()
+
+	verificationURI := getIssuer(r) + "/oauth/device"
+	w.Header().Set("Cache-Control", "no-store")
+	RenderResponse(w, http.StatusOK, &OAuthDeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(oauthCodeTTL.Seconds()),
+		Interval:                oauthDevicePollSeconds,
+	})
+}
+
+// OAuthDeviceVerifyHandle approves the device authorization with the given `user_code`.
+// The user is `OAuthProvider.Subject` or the `login_hint` query parameter.
+func OAuthDeviceVerifyHandle(w http.ResponseWriter, r *http.Request) {
+	p := getConfig(r).OAuth
+	userCode := r.URL.Query().Get("user_code")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, grant := range p.devices {
+		if grant.userCode == userCode && time.Now().Before(grant.expires) {
+			grant.approved = true
+			if subject := r.URL.Query().Get("login_hint"); subject != "" {
+				grant.subject = subject
+			}
+			RenderResponse(w, http.StatusOK, &OAuthDeviceVerifyResponse{Approved: true, UserCode: userCode})
+			return
+		}
+	}
+	RenderError(w, "user_code: unknown or expired", http.StatusNotFound)
+}
+
+// OAuthUserinfoHandle returns claims about the user authenticated by the access token.
+func OAuthUserinfoHandle(w http.ResponseWriter, r *http.Request) {
+	p := getConfig(r).OAuth
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		writeBearerChallenge(w, http.StatusUnauthorized, "", "", "")
+		return
+	}
+
+	claims, err := p.verifyToken(strings.TrimSpace(token))
+	if err != nil {
+		writeBearerChallenge(w, http.StatusUnauthorized, "invalid_token", err.Error(), "")
+		return
+	}
+
+	sub, _ := claims["sub"].(string)
+	RenderResponse(w, http.StatusOK, &OAuthUserinfoResponse{
+		Sub:               sub,
+		Name:              sub,
+		PreferredUsername: sub,
+		Email:             fmt.Sprintf("%s@example.com", sub),
+		EmailVerified:     true,
+	})
+}
+
+// OAuthIntrospectHandle is the token introspection endpoint (RFC 7662).
+// It returns `active: false` for tokens which weren't issued by the provider or are expired.
+func OAuthIntrospectHandle(w http.ResponseWriter, r *http.Request) {
+	p := getConfig(r).OAuth
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	resp := map[string]interface{}{"active": false}
+
+	token := r.PostForm.Get("token")
+	if claims, err := p.verifyToken(token); err == nil {
+		for k, v := range claims {
+			resp[k] = v
+		}
+		resp["active"] = true
+		resp["token_type"] = "Bearer"
+	} else {
+		p.mu.Lock()
+		grant, ok := p.refreshTokens[token]
+		p.mu.Unlock()
+		if ok && time.Now().Before(grant.expires) {
+			resp["active"] = true
+			resp["token_type"] = "refresh_token"
+			resp["client_id"] = grant.clientID
+			resp["sub"] = grant.subject
+			resp["scope"] = grant.scope
+			resp["exp"] = grant.expires.Unix()
+		}
+	}
+	RenderResponse(w, http.StatusOK, resp)
+}
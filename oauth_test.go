@@ -0,0 +1,386 @@
+package httpbulb
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OAuthSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	client     *http.Client
+}
+
+func (s *OAuthSuite) SetupSuite() {
+	provider := NewOAuthProvider()
+	provider.Clients = map[string]string{
+		"service": "service-secret",
+		"spa":     "",
+	}
+	s.testServer = httptest.NewServer(NewRouterWithConfig(Config{OAuth: provider}))
+	s.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (s *OAuthSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func (s *OAuthSuite) postForm(path string, form url.Values) (*http.Response, []byte) {
+	resp, err := s.client.PostForm(s.testServer.URL+path, form)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+	return resp, body
+}
+
+func (s *OAuthSuite) token(form url.Values) *OAuthTokenResponse {
+	resp, body := s.postForm("/oauth/token", form)
+	s.Require().Equal(http.StatusOK, resp.StatusCode, string(body))
+	s.Require().Equal("no-store", resp.Header.Get("Cache-Control"))
+
+	result := new(OAuthTokenResponse)
+	s.Require().NoError(json.Unmarshal(body, result))
+	s.Require().Equal("Bearer", result.TokenType)
+	return result
+}
+
+func (s *OAuthSuite) bearerClaims(token string) map[string]interface{} {
+	req, err := http.NewRequest(http.MethodGet, s.testServer.URL+"/bearer/jwt", nil)
+	s.Require().NoError(err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	result := new(JWTResponse)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	return result.Claims
+}
+
+func (s *OAuthSuite) TestDiscovery() {
+	resp, err := s.client.Get(s.testServer.URL + "/.well-known/openid-configuration")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	result := new(OIDCDiscoveryResponse)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	s.Require().Equal(s.testServer.URL, result.Issuer)
+	s.Require().Equal(s.testServer.URL+"/oauth/token", result.TokenEndpoint)
+	s.Require().Equal(s.testServer.URL+"/.well-known/jwks.json", result.JwksURI)
+	s.Require().Equal([]string{"ES256"}, result.IDTokenSigningAlgValuesSupported)
+
+	resp, err = s.client.Get(result.JwksURI)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	jwks := new(JWKSResponse)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(jwks))
+	s.Require().Len(jwks.Keys, 1)
+	s.Require().Equal("httpbulb-oauth", jwks.Keys[0].Kid)
+}
+
+func (s *OAuthSuite) TestClientCredentials() {
+	result := s.token(url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"service"},
+		"client_secret": {"service-secret"},
+		"scope":         {"read"},
+	})
+	s.Require().Empty(result.RefreshToken)
+	s.Require().Empty(result.IDToken)
+
+	claims := s.bearerClaims(result.AccessToken)
+	s.Require().Equal("service", claims["sub"])
+	s.Require().Equal("read", claims["scope"])
+	s.Require().Equal(s.testServer.URL, claims["iss"])
+
+	type testArgs struct {
+		name     string
+		form     url.Values
+		wantCode int
+		wantErr  string
+	}
+
+	tests := []testArgs{
+		{
+			name:     "wrong secret",
+			form:     url.Values{"grant_type": {"client_credentials"}, "client_id": {"service"}, "client_secret": {"wrong"}},
+			wantCode: http.StatusUnauthorized,
+			wantErr:  "invalid_client",
+		},
+		{
+			name:     "public client",
+			form:     url.Values{"grant_type": {"client_credentials"}, "client_id": {"spa"}},
+			wantCode: http.StatusUnauthorized,
+			wantErr:  "invalid_client",
+		},
+		{
+			name:     "unsupported grant type",
+			form:     url.Values{"grant_type": {"password"}, "client_id": {"spa"}},
+			wantCode: http.StatusBadRequest,
+			wantErr:  "unsupported_grant_type",
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			resp, body := s.postForm("/oauth/token", tt.form)
+			require.Equal(t, tt.wantCode, resp.StatusCode)
+
+			result := new(OAuthErrorResponse)
+			require.NoError(t, json.Unmarshal(body, result))
+			require.Equal(t, tt.wantErr, result.Error)
+		})
+	}
+}
+
+func (s *OAuthSuite) authorize(query url.Values) url.Values {
+	resp, err := s.client.Get(s.testServer.URL + "/oauth/authorize?" + query.Encode())
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	s.Require().NoError(err)
+	s.Require().Equal("app.example", location.Host)
+	return location.Query()
+}
+
+func (s *OAuthSuite) TestAuthorizationCode() {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	params := s.authorize(url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {"https://app.example/callback"},
+		"scope":                 {"openid profile"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"login_hint":            {"alice"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	})
+	s.Require().Equal("xyz", params.Get("state"))
+	code := params.Get("code")
+	s.Require().NotEmpty(code)
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"spa"},
+		"code":          {code},
+		"redirect_uri":  {"https://app.example/callback"},
+		"code_verifier": {verifier},
+	}
+	result := s.token(form)
+	s.Require().NotEmpty(result.RefreshToken)
+	s.Require().Equal("openid profile", result.Scope)
+
+	idClaims := s.bearerClaims(result.IDToken)
+	s.Require().Equal("alice", idClaims["sub"])
+	s.Require().Equal("spa", idClaims["aud"])
+	s.Require().Equal("n-0S6", idClaims["nonce"])
+
+	s.T().Run("code reuse", func(t *testing.T) {
+		resp, body := s.postForm("/oauth/token", form)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		require.Contains(t, string(body), "invalid_grant")
+	})
+
+	s.T().Run("wrong verifier", func(t *testing.T) {
+		params := s.authorize(url.Values{
+			"response_type":         {"code"},
+			"client_id":             {"spa"},
+			"redirect_uri":          {"https://app.example/callback"},
+			"code_challenge":        {challenge},
+			"code_challenge_method": {"S256"},
+		})
+		resp, body := s.postForm("/oauth/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"spa"},
+			"code":          {params.Get("code")},
+			"redirect_uri":  {"https://app.example/callback"},
+			"code_verifier": {"wrong"},
+		})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		require.Contains(t, string(body), "code_verifier is invalid")
+	})
+
+	s.T().Run("unsupported response type", func(t *testing.T) {
+		params := s.authorize(url.Values{
+			"response_type": {"token"},
+			"client_id":     {"spa"},
+			"redirect_uri":  {"https://app.example/callback"},
+		})
+		require.Equal(t, "unsupported_response_type", params.Get("error"))
+		require.Empty(t, params.Get("code"))
+	})
+
+	s.T().Run("refresh token rotation", func(t *testing.T) {
+		refreshForm := url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {"spa"},
+			"refresh_token": {result.RefreshToken},
+		}
+		refreshed := s.token(refreshForm)
+		require.NotEmpty(t, refreshed.AccessToken)
+		require.NotEqual(t, result.RefreshToken, refreshed.RefreshToken)
+
+		resp, body := s.postForm("/oauth/token", refreshForm)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		require.Contains(t, string(body), "invalid_grant")
+	})
+}
+
+func (s *OAuthSuite) TestDeviceCode() {
+	resp, body := s.postForm("/oauth/device/code", url.Values{"client_id": {"spa"}, "scope": {"openid"}})
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	device := new(OAuthDeviceCodeResponse)
+	s.Require().NoError(json.Unmarshal(body, device))
+	s.Require().Regexp(`^[A-Z]{4}-[A-Z]{4}$`, device.UserCode)
+
+	tokenForm := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"client_id":   {"spa"},
+		"device_code": {device.DeviceCode},
+	}
+
+	resp, body = s.postForm("/oauth/token", tokenForm)
+	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Require().Contains(string(body), "authorization_pending")
+
+	verifyResp, err := s.client.Get(device.VerificationURIComplete + "&login_hint=bob")
+	s.Require().NoError(err)
+	verifyResp.Body.Close()
+	s.Require().Equal(http.StatusOK, verifyResp.StatusCode)
+
+	result := s.token(tokenForm)
+	s.Require().Equal("bob", s.bearerClaims(result.IDToken)["sub"])
+
+	verifyResp, err = s.client.Get(s.testServer.URL + "/oauth/device?user_code=UNKNOWN")
+	s.Require().NoError(err)
+	verifyResp.Body.Close()
+	s.Require().Equal(http.StatusNotFound, verifyResp.StatusCode)
+}
+
+func (s *OAuthSuite) TestUserinfoAndIntrospection() {
+	result := s.token(url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"service"},
+		"client_secret": {"service-secret"},
+	})
+
+	req, err := http.NewRequest(http.MethodGet, s.testServer.URL+"/oauth/userinfo", nil)
+	s.Require().NoError(err)
+	req.Header.Set("Authorization", "Bearer "+result.AccessToken)
+	resp, err := s.client.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	userinfo := new(OAuthUserinfoResponse)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(userinfo))
+	s.Require().Equal("service", userinfo.Sub)
+	s.Require().Equal("service@example.com", userinfo.Email)
+
+	req.Header.Set("Authorization", "Bearer invalid")
+	resp, err = s.client.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Require().True(strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), `Bearer realm="httpbulb", error="invalid_token"`))
+
+	for token, wantActive := range map[string]bool{result.AccessToken: true, "invalid": false} {
+		_, body := s.postForm("/oauth/introspect", url.Values{"token": {token}})
+
+		introspection := make(map[string]interface{})
+		s.Require().NoError(json.Unmarshal(body, &introspection))
+		s.Require().Equal(wantActive, introspection["active"])
+		if wantActive {
+			s.Require().Equal("service", introspection["client_id"])
+		}
+	}
+}
+
+func TestOAuthSuite(t *testing.T) {
+	suite.Run(t, new(OAuthSuite))
+}
+
+func TestOAuthProviderZeroValue(t *testing.T) {
+	// a provider literal without the constructor
+	provider := &OAuthProvider{Clients: map[string]string{"spa": ""}}
+	testServer := httptest.NewServer(NewRouterWithConfig(Config{OAuth: provider}))
+	defer testServer.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"spa"},
+		"redirect_uri":  {"https://app.example/callback"},
+	}
+	resp, err := client.Get(testServer.URL + "/oauth/authorize?" + query.Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	resp, err = client.PostForm(testServer.URL+"/oauth/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"client_id":    {"spa"},
+		"code":         {location.Query().Get("code")},
+		"redirect_uri": {"https://app.example/callback"},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	result := new(OAuthTokenResponse)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	require.Equal(t, 3600, result.ExpiresIn)
+	require.NotEmpty(t, result.RefreshToken)
+
+	claims, err := provider.verifyToken(result.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "httpbulb", claims["sub"])
+
+	resp, err = client.PostForm(testServer.URL+"/oauth/device/code", url.Values{"client_id": {"spa"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestOAuthGrantsExpire(t *testing.T) {
+	provider := &OAuthProvider{}
+	provider.addGrant(&provider.codes, "expired", &oauthGrant{expires: time.Now().Add(-time.Second)})
+	provider.addGrant(&provider.codes, "valid", &oauthGrant{expires: time.Now().Add(time.Minute)})
+	provider.addGrant(&provider.codes, "new", &oauthGrant{expires: time.Now().Add(time.Minute)})
+
+	require.NotContains(t, provider.codes, "expired")
+	require.Len(t, provider.codes, 2)
+}
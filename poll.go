@@ -0,0 +1,241 @@
+package httpbulb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultPollBufferSize = 100
+	defaultPollTimeout    = 30 * time.Second
+	maxPollTimeout        = 110 * time.Second
+	maxPollMessageSize    = 64 * 1024
+)
+
+// PollBroker keeps messages published to long-polling channels (`/poll/{channel}`).
+// Every channel keeps a bounded buffer of the last messages,
+// so clients can resume from the last received sequence number (cursor).
+//
+// A zero PollBroker is usable and keeps up to 100 last messages per channel.
+// It is guarded by a mutex, so it can be shared by concurrent requests.
+type PollBroker struct {
+	mu         sync.Mutex
+	bufferSize int
+	channels   map[string]*pollChannel
+	// created is closed when a new channel is created by `Publish`
+	created chan struct{}
+}
+
+type pollChannel struct {
+	seq      uint64
+	messages []PollMessage
+	// notify is closed when a new message is published
+	notify chan struct{}
+}
+
+// NewPollBroker returns a new PollBroker which keeps up to bufferSize last messages per channel.
+// If bufferSize is not positive, the default size (100) is used.
+func NewPollBroker(bufferSize int) *PollBroker {
+	return &PollBroker{bufferSize: bufferSize}
+}
+
+// Publish publishes the data to the channel and wakes up all waiting requests.
+func (b *PollBroker) Publish(channel string, data []byte) PollMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.init()
+
+	ch, ok := b.channels[channel]
+	if !ok {
+		// channels are created only by publishing, so reads of unknown channels don't allocate them
+		ch = &pollChannel{notify: make(chan struct{})}
+		b.channels[channel] = ch
+		close(b.created)
+		b.created = make(chan struct{})
+	}
+	ch.seq++
+	msg := PollMessage{Seq: ch.seq, Data: string(data), Time: time.Now().UTC()}
+
+	ch.messages = append(ch.messages, msg)
+	if size := b.size(); len(ch.messages) > size {
+		ch.messages = ch.messages[len(ch.messages)-size:]
+	}
+
+	close(ch.notify)
+	ch.notify = make(chan struct{})
+	return msg
+}
+
+// Cursor returns the sequence number of the last message published to the channel,
+// or 0 if nothing was published to the channel yet.
+func (b *PollBroker) Cursor(channel string) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch, ok := b.channels[channel]; ok {
+		return ch.seq
+	}
+	return 0
+}
+
+// Wait returns messages published to the channel after the cursor.
+// If there are no such messages, it waits until a new message is published,
+// the timeout expires or the context is canceled.
+// `missed` is the number of messages after the cursor which are already dropped from the buffer.
+func (b *PollBroker) Wait(ctx context.Context, channel string, cursor uint64, timeout time.Duration) (messages []PollMessage, missed uint64, err error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		var notify chan struct{}
+		messages, missed, notify = b.since(channel, cursor)
+		if len(messages) > 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-timer.C:
+			return
+		case <-notify:
+		}
+	}
+}
+
+func (b *PollBroker) since(channel string, cursor uint64) (messages []PollMessage, missed uint64, notify chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.init()
+
+	ch, ok := b.channels[channel]
+	if !ok {
+		// wait until the channel is created
+		notify = b.created
+		return
+	}
+	notify = ch.notify
+
+	if cursor >= ch.seq || len(ch.messages) == 0 {
+		return
+	}
+
+	oldest := ch.messages[0].Seq
+	if cursor+1 < oldest {
+		missed = oldest - cursor - 1
+	}
+
+	for _, msg := range ch.messages {
+		if msg.Seq > cursor {
+			messages = append(messages, msg)
+		}
+	}
+	return
+}
+
+// init allocates the channels of a zero PollBroker, it must be called with the lock held.
+func (b *PollBroker) init() {
+	if b.channels == nil {
+		b.channels = make(map[string]*pollChannel)
+	}
+	if b.created == nil {
+		b.created = make(chan struct{})
+	}
+}
+
+func (b *PollBroker) size() int {
+	if b.bufferSize <= 0 {
+		return defaultPollBufferSize
+	}
+	return b.bufferSize
+}
+
+// PollHandle holds the request until a message is published to the channel or the timeout expires.
+//
+// Query parameters:
+//   - `cursor` is the sequence number of the last received message,
+//     if it is not set, only new messages are awaited; a cursor ahead of the channel is rejected with 400;
+//   - `timeout` is a duration (`10s`) or a number of seconds to wait, default is 30s, max is 110s.
+//
+// It returns 200 with the messages published after the cursor, or 204 if the timeout expired.
+// The current cursor is always sent in `X-Poll-Cursor` header.
+func PollHandle(w http.ResponseWriter, r *http.Request) {
+	channel := chi.URLParam(r, "channel")
+	broker := getConfig(r).PollBroker
+
+	query := r.URL.Query()
+
+	var cursor uint64
+	var err error
+	if cursorParam := query.Get("cursor"); cursorParam != "" {
+		if cursor, err = strconv.ParseUint(cursorParam, 10, 64); err != nil {
+			RenderError(w, "cursor: bad parameter", http.StatusBadRequest)
+			return
+		}
+		// the cursor can't be ahead of the channel, otherwise the request waits until the channel catches up
+		if cursor > broker.Cursor(channel) {
+			RenderError(w, "cursor: ahead of the channel", http.StatusBadRequest)
+			return
+		}
+	} else {
+		cursor = broker.Cursor(channel)
+	}
+
+	timeout := defaultPollTimeout
+	if timeoutParam := query.Get("timeout"); timeoutParam != "" {
+		if timeout, err = parseInterval(timeoutParam); err != nil {
+			RenderError(w, "timeout: bad parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	timeout = min(timeout, maxPollTimeout)
+
+	messages, missed, err := broker.Wait(r.Context(), channel, cursor, timeout)
+	if err != nil {
+		// the client has gone away
+		return
+	}
+
+	if len(messages) == 0 {
+		w.Header().Set("X-Poll-Cursor", strconv.FormatUint(cursor, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	next := messages[len(messages)-1].Seq
+	w.Header().Set("X-Poll-Cursor", strconv.FormatUint(next, 10))
+	RenderResponse(w, http.StatusOK, &PollResponse{
+		Channel:  channel,
+		Cursor:   next,
+		Missed:   missed,
+		Messages: messages,
+	})
+}
+
+// PollPublishHandle publishes the request body to the channel (max 64KB)
+// and returns the published message.
+func PollPublishHandle(w http.ResponseWriter, r *http.Request) {
+	channel := chi.URLParam(r, "channel")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPollMessageSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		RenderError(w, err.Error(), status)
+		return
+	}
+
+	msg := getConfig(r).PollBroker.Publish(channel, body)
+	w.Header().Set("X-Poll-Cursor", strconv.FormatUint(msg.Seq, 10))
+	RenderResponse(w, http.StatusOK, msg)
+}
@@ -0,0 +1,183 @@
+package httpbulb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PollSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	client     *http.Client
+	broker     *PollBroker
+}
+
+func (s *PollSuite) SetupSuite() {
+	s.broker = NewPollBroker(3)
+	s.testServer = httptest.NewServer(NewRouterWithConfig(Config{PollBroker: s.broker}))
+	s.client = &http.Client{Timeout: 10 * time.Second}
+}
+
+func (s *PollSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func (s *PollSuite) poll(channel, query string) (*http.Response, *PollResponse) {
+	resp, err := s.client.Get(fmt.Sprintf("%s/poll/%s?%s", s.testServer.URL, channel, query))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	result := new(PollResponse)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	return resp, result
+}
+
+func (s *PollSuite) TestTimeout() {
+	started := time.Now()
+	resp, _ := s.poll("timeout", "timeout=200ms")
+	s.Require().Equal(http.StatusNoContent, resp.StatusCode)
+	s.Require().Equal("0", resp.Header.Get("X-Poll-Cursor"))
+	s.Require().GreaterOrEqual(time.Since(started), 200*time.Millisecond)
+
+	// reads don't create channels
+	s.broker.mu.Lock()
+	s.Require().NotContains(s.broker.channels, "timeout")
+	s.broker.mu.Unlock()
+}
+
+func (s *PollSuite) TestPublishWhileWaiting() {
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		req, _ := http.NewRequest(http.MethodPost, s.testServer.URL+"/poll/wait", strings.NewReader("hello"))
+		resp, err := s.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	resp, result := s.poll("wait", "timeout=5")
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("wait", result.Channel)
+	s.Require().Len(result.Messages, 1)
+	s.Require().Equal("hello", result.Messages[0].Data)
+	s.Require().Equal(result.Messages[0].Seq, result.Cursor)
+	s.Require().Equal(fmt.Sprint(result.Cursor), resp.Header.Get("X-Poll-Cursor"))
+}
+
+func (s *PollSuite) TestResume() {
+	for i := 1; i <= 5; i++ {
+		s.broker.Publish("resume", []byte(fmt.Sprintf("msg-%d", i)))
+	}
+
+	type testArgs struct {
+		name       string
+		cursor     uint64
+		wantData   []string
+		wantMissed uint64
+	}
+
+	tests := []testArgs{
+		{name: "from the middle", cursor: 3, wantData: []string{"msg-4", "msg-5"}},
+		{name: "from the oldest buffered", cursor: 2, wantData: []string{"msg-3", "msg-4", "msg-5"}},
+		{name: "dropped messages", cursor: 0, wantData: []string{"msg-3", "msg-4", "msg-5"}, wantMissed: 2},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			resp, result := s.poll("resume", fmt.Sprintf("cursor=%d&timeout=1", tt.cursor))
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var data []string
+			for _, msg := range result.Messages {
+				data = append(data, msg.Data)
+			}
+			require.Equal(t, tt.wantData, data)
+			require.Equal(t, tt.wantMissed, result.Missed)
+			require.Equal(t, uint64(5), result.Cursor)
+		})
+	}
+}
+
+func (s *PollSuite) TestBadParams() {
+	for _, query := range []string{"cursor=-1", "cursor=1", "timeout=abc"} {
+		s.T().Run(query, func(t *testing.T) {
+			resp, _ := s.poll("bad", query)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestPollSuite(t *testing.T) {
+	suite.Run(t, new(PollSuite))
+}
+
+func TestPollBrokerCancel(t *testing.T) {
+	broker := NewPollBroker(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	messages, _, err := broker.Wait(ctx, "cancel", 0, 5*time.Second)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, messages)
+}
+
+func TestPollBrokerZeroValue(t *testing.T) {
+	broker := &PollBroker{}
+	require.Equal(t, uint64(0), broker.Cursor("zero"))
+
+	messages, _, err := broker.Wait(context.Background(), "zero", 0, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Empty(t, messages)
+
+	for i := 0; i < defaultPollBufferSize+1; i++ {
+		broker.Publish("zero", []byte("data"))
+	}
+	messages, missed, err := broker.Wait(context.Background(), "zero", 0, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, defaultPollBufferSize)
+	require.Equal(t, uint64(1), missed)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestPollPublishBodyErrors(t *testing.T) {
+	type testArgs struct {
+		name       string
+		body       io.Reader
+		wantStatus int
+	}
+
+	tests := []testArgs{
+		{name: "too large", body: strings.NewReader(strings.Repeat("a", maxPollMessageSize+1)), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "read error", body: failingReader{}, wantStatus: http.StatusBadRequest},
+	}
+
+	router := NewRouterWithConfig(Config{PollBroker: &PollBroker{}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/poll/body", tt.body))
+			require.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,525 @@
+package httpbulb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	// rawMaxHTTP1Bytes is the maximum number of recent bytes kept for HTTP/1.x requests of a connection,
+	// larger request heads are not captured.
+	rawMaxHTTP1Bytes = 64 << 10
+	// rawMaxHeaderBlock is the maximum size of an HTTP/2 header block, the capture stops on larger blocks.
+	rawMaxHeaderBlock = 1 << 20
+	// rawMaxStreams is the maximum number of HTTP/2 streams waiting to be served.
+	rawMaxStreams = 100
+	// rawTableSize is the HPACK dynamic table size, which is advertised by the HTTP/2 server.
+	rawTableSize = 4096
+)
+
+const (
+	rawStateDetect = iota
+	rawStateHTTP1
+	rawStateHTTP2
+	rawStateOff
+)
+
+const (
+	h2FrameHeaders      = 0x1
+	h2FrameContinuation = 0x9
+	h2FlagEndHeaders    = 0x4
+	h2FlagPadded        = 0x8
+	h2FlagPriority      = 0x20
+)
+
+type rawConnKey struct{}
+
+type rawRequestKey struct{}
+
+type rawTLSConnKey struct{}
+
+// rawConn records bytes read from the connection:
+// HTTP/1.x request heads as they are, and HTTP/2 header blocks decoded in order.
+type rawConn struct {
+	net.Conn
+
+	mu    sync.Mutex
+	state int
+	http1 []byte
+	// skip is the number of body bytes of the last HTTP/1.x request, which are not recorded
+	skip int64
+	h2   *rawH2Parser
+}
+
+// rawTLSConn is a rawConn over TLS, which records the plain text
+// and exposes the TLS connection state to the HTTP/2 server.
+type rawTLSConn struct {
+	*rawConn
+	tlsConn *tls.Conn
+}
+
+func (c *rawTLSConn) ConnectionState() tls.ConnectionState {
+	return c.tlsConn.ConnectionState()
+}
+
+func (c *rawConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	if n > 0 {
+		c.record(p[:n])
+	}
+	return
+}
+
+func (c *rawConn) record(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == rawStateDetect {
+		c.state = rawStateHTTP1
+		if b[0] == 0x16 {
+			// a TLS handshake record, the plain text is recorded by `NewRawTLSListener`,
+			// or by `ConfigureRawCapture` for HTTP/2 only
+			c.state = rawStateOff
+		}
+	}
+
+	switch c.state {
+	case rawStateHTTP1:
+		if c.skip > 0 {
+			n := min(c.skip, int64(len(b)))
+			c.skip -= n
+			b = b[n:]
+		}
+		// the preface may be split between reads
+		from := len(c.http1) - len(http2.ClientPreface) + 1
+		if from < 0 {
+			from = 0
+		}
+		c.http1 = append(c.http1, b...)
+		if i := bytes.Index(c.http1[from:], []byte(http2.ClientPreface)); i >= 0 {
+			// h2c with prior knowledge or after `Upgrade: h2c`, the upgrade request head is kept
+			i += from
+			rest := c.http1[i+len(http2.ClientPreface):]
+			c.http1 = c.http1[:i]
+			c.state = rawStateHTTP2
+			c.h2 = newRawH2Parser()
+			c.h2.write(rest)
+			return
+		}
+		if len(c.http1) > rawMaxHTTP1Bytes {
+			c.http1 = append([]byte(nil), c.http1[len(c.http1)-rawMaxHTTP1Bytes:]...)
+		}
+	case rawStateHTTP2:
+		c.h2.write(b)
+	}
+}
+
+// request returns the captured request and drops everything before it.
+func (c *rawConn) request(r *http.Request) *RawRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r.ProtoMajor == 2 {
+		if c.h2 == nil {
+			return nil
+		}
+		return c.h2.request(r)
+	}
+	return c.http1Request(r)
+}
+
+// http1Request finds the request head by the request line.
+func (c *rawConn) http1Request(r *http.Request) *RawRequest {
+	prefix := []byte(r.Method + " " + r.RequestURI + " ")
+
+	for pos := 0; pos < len(c.http1); {
+		i := bytes.Index(c.http1[pos:], prefix)
+		if i < 0 {
+			return nil
+		}
+		start := pos + i
+		pos = start + 1
+		if start > 0 && c.http1[start-1] != '\n' {
+			continue
+		}
+
+		end := headEnd(c.http1[start:])
+		if end < 0 {
+			return nil
+		}
+		head := string(c.http1[start : start+end])
+		c.http1 = c.http1[start+end:]
+		if r.ContentLength > 0 {
+			// the body can't be confused with the next request
+			n := min(r.ContentLength, int64(len(c.http1)))
+			c.http1 = c.http1[n:]
+			c.skip = r.ContentLength - n
+		}
+		return parseRawHead(r, head)
+	}
+	return nil
+}
+
+// headEnd returns the length of the request head including the empty line, or -1.
+func headEnd(b []byte) int {
+	end := -1
+	if i := bytes.Index(b, []byte("\n\r\n")); i >= 0 {
+		end = i + 3
+	}
+	if i := bytes.Index(b, []byte("\n\n")); i >= 0 && (end < 0 || i+2 < end) {
+		end = i + 2
+	}
+	return end
+}
+
+// parseRawHead splits the request head into the request line and header fields,
+// keeping their case, order and duplicates.
+func parseRawHead(r *http.Request, head string) *RawRequest {
+	lines := strings.Split(strings.TrimRight(head, "\r\n"), "\n")
+	raw := &RawRequest{
+		Proto:       r.Proto,
+		Raw:         head,
+		RequestLine: strings.TrimSuffix(lines[0], "\r"),
+		Headers:     []RawHeader{},
+	}
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(raw.Headers) > 0 {
+			// obsolete line folding
+			last := &raw.Headers[len(raw.Headers)-1]
+			last.Value += " " + strings.Trim(line, " \t")
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		raw.Headers = append(raw.Headers, RawHeader{Name: name, Value: strings.Trim(value, " \t")})
+	}
+	return raw
+}
+
+// rawH2Stream is a decoded request header block of an HTTP/2 stream.
+type rawH2Stream struct {
+	id     uint32
+	method string
+	path   string
+	fields []hpack.HeaderField
+}
+
+// rawH2Parser reads HTTP/2 frames sent by the client and decodes request header blocks.
+// Frames except HEADERS and CONTINUATION are skipped.
+type rawH2Parser struct {
+	pending []byte
+	skip    int
+	dec     *hpack.Decoder
+	block   []byte
+	streams []rawH2Stream
+	failed  bool
+}
+
+func newRawH2Parser() *rawH2Parser {
+	return &rawH2Parser{dec: hpack.NewDecoder(rawTableSize, nil)}
+}
+
+func (p *rawH2Parser) write(b []byte) {
+	if p.failed {
+		return
+	}
+	p.pending = append(p.pending, b...)
+
+	for !p.failed {
+		if p.skip > 0 {
+			if len(p.pending) == 0 {
+				break
+			}
+			n := min(p.skip, len(p.pending))
+			p.skip -= n
+			p.pending = p.pending[n:]
+			continue
+		}
+		if len(p.pending) < 9 {
+			break
+		}
+
+		length := int(p.pending[0])<<16 | int(p.pending[1])<<8 | int(p.pending[2])
+		typ, flags := p.pending[3], p.pending[4]
+		streamID := binary.BigEndian.Uint32(p.pending[5:9]) & 0x7fffffff
+		if typ != h2FrameHeaders && typ != h2FrameContinuation {
+			p.pending = p.pending[9:]
+			p.skip = length
+			continue
+		}
+		if length+len(p.block) > rawMaxHeaderBlock {
+			p.failed = true
+			break
+		}
+		if len(p.pending) < 9+length {
+			break
+		}
+		payload := p.pending[9 : 9+length]
+		p.pending = p.pending[9+length:]
+		p.frame(typ, flags, streamID, payload)
+	}
+
+	if len(p.pending) == 0 {
+		p.pending = nil
+	}
+}
+
+func (p *rawH2Parser) frame(typ, flags byte, streamID uint32, payload []byte) {
+	if typ == h2FrameHeaders {
+		if flags&h2FlagPadded != 0 {
+			if len(payload) < 1 || int(payload[0]) >= len(payload) {
+				p.failed = true
+				return
+			}
+			payload = payload[1 : len(payload)-int(payload[0])]
+		}
+		if flags&h2FlagPriority != 0 {
+			if len(payload) < 5 {
+				p.failed = true
+				return
+			}
+			payload = payload[5:]
+		}
+		p.block = p.block[:0]
+	}
+	p.block = append(p.block, payload...)
+	if flags&h2FlagEndHeaders == 0 {
+		return
+	}
+
+	// every block must be decoded to keep the dynamic table in sync
+	fields, err := p.dec.DecodeFull(p.block)
+	p.block = p.block[:0]
+	if err != nil {
+		p.failed = true
+		return
+	}
+
+	stream := rawH2Stream{id: streamID, fields: fields}
+	for _, f := range fields {
+		switch f.Name {
+		case ":method":
+			stream.method = f.Value
+		case ":path":
+			stream.path = f.Value
+		}
+	}
+	if stream.method == "" {
+		// trailers
+		return
+	}
+	if len(p.streams) == rawMaxStreams {
+		p.streams = p.streams[1:]
+	}
+	p.streams = append(p.streams, stream)
+}
+
+// request returns the first stream with the method and the path of the request.
+func (p *rawH2Parser) request(r *http.Request) *RawRequest {
+	for i, stream := range p.streams {
+		if stream.method != r.Method || stream.path != r.RequestURI {
+			continue
+		}
+		p.streams = append(p.streams[:i], p.streams[i+1:]...)
+
+		raw := &RawRequest{Proto: r.Proto, StreamID: stream.id, Headers: make([]RawHeader, 0, len(stream.fields))}
+		for _, f := range stream.fields {
+			raw.Headers = append(raw.Headers, RawHeader{Name: f.Name, Value: f.Value, Sensitive: f.Sensitive})
+		}
+		return raw
+	}
+	return nil
+}
+
+type rawListener struct {
+	net.Listener
+	config *tls.Config
+}
+
+func (ln rawListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if ln.config != nil {
+		// the handshake is done on the first read by the server
+		tlsConn := tls.Server(c, ln.config)
+		return &rawTLSConn{rawConn: &rawConn{Conn: tlsConn}, tlsConn: tlsConn}, nil
+	}
+	return &rawConn{Conn: c}, nil
+}
+
+// rawBufConn reads data buffered by the HTTP/1 server before the connection was hijacked.
+type rawBufConn struct {
+	*rawTLSConn
+	r *bufio.Reader
+}
+
+func (c *rawBufConn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		return c.rawTLSConn.Read(p)
+	}
+	n := c.r.Buffered()
+	if n == 0 {
+		c.r = nil
+		return c.rawTLSConn.Read(p)
+	}
+	return c.r.Read(p[:min(n, len(p))])
+}
+
+// NewRawListener wraps the listener to record requests as they are received on the wire,
+// they are returned by `/raw` and in the `raw` field of the methods response.
+// HTTP/1.x request heads are recorded as is, HTTP/2 header blocks (h2c) are decoded in order.
+// TLS connections are not recorded by the listener, `ConfigureRawCapture` records HTTP/2 over TLS,
+// use `NewRawTLSListener` to record HTTP/1.x over TLS as well.
+//
+// The server must be configured by `ConfigureRawCapture`.
+func NewRawListener(ln net.Listener) net.Listener {
+	return rawListener{Listener: ln}
+}
+
+// NewRawTLSListener wraps the listener to accept TLS connections with the config
+// and to record requests in the plain text, both HTTP/1.x and HTTP/2.
+// The listener replaces `http.Server.ServeTLS`: the server must serve it with `http.Server.Serve`
+// and it must be configured by `ConfigureRawCapture` before, so HTTP/2 is offered by ALPN.
+func NewRawTLSListener(ln net.Listener, config *tls.Config) net.Listener {
+	return rawListener{Listener: ln, config: config}
+}
+
+// ConfigureRawCapture configures the server to pass connections of `NewRawListener` and `NewRawTLSListener`
+// to handlers and to record header blocks of HTTP/2 connections over TLS.
+// It must be called after `http.Server.TLSConfig` and `http.Server.Handler` are set.
+func ConfigureRawCapture(srv *http.Server) error {
+	connContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		switch rc := c.(type) {
+		case *rawConn:
+			ctx = context.WithValue(ctx, rawConnKey{}, rc)
+		case *rawTLSConn:
+			ctx = context.WithValue(ctx, rawConnKey{}, rc.rawConn)
+			ctx = context.WithValue(ctx, rawTLSConnKey{}, rc)
+		}
+		return ctx
+	}
+
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	srv.Handler = rawTLSHandler(srv, h2s)
+	srv.TLSNextProto[http2.NextProtoTLS] = func(hs *http.Server, c *tls.Conn, h http.Handler) {
+		ctx := context.Background()
+		if bc, ok := h.(interface{ BaseContext() context.Context }); ok {
+			ctx = bc.BaseContext()
+		}
+		rc := &rawTLSConn{rawConn: &rawConn{Conn: c}, tlsConn: c}
+		h2s.ServeConn(rc, &http2.ServeConnOpts{
+			Context:    context.WithValue(ctx, rawConnKey{}, rc.rawConn),
+			Handler:    h,
+			BaseConfig: hs,
+		})
+	}
+	return nil
+}
+
+// rawTLSHandler serves connections of `NewRawTLSListener`, which the server sees as plain connections:
+// it sets the TLS state of HTTP/1.x requests and serves HTTP/2 negotiated by ALPN.
+func rawTLSHandler(srv *http.Server, h2s *http2.Server) http.Handler {
+	h := srv.Handler
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		tc, ok := r.Context().Value(rawTLSConnKey{}).(*rawTLSConn)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == "PRI" && r.URL.Path == "*" && r.Proto == "HTTP/2.0" {
+			serveRawH2(w, r, tc, srv, h2s, h)
+			return
+		}
+		state := tc.ConnectionState()
+		r = r.WithContext(r.Context())
+		r.TLS = &state
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// serveRawH2 takes over the connection after the client preface and serves it by the HTTP/2 server.
+func serveRawH2(w http.ResponseWriter, r *http.Request, tc *rawTLSConn, srv *http.Server, h2s *http2.Server, h http.Handler) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		RenderError(w, "the connection can't be hijacked", http.StatusInternalServerError)
+		return
+	}
+	_, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer tc.Close()
+
+	// the rest of the client preface
+	const prefaceRest = "SM\r\n\r\n"
+	buf := make([]byte, len(prefaceRest))
+	if _, err = io.ReadFull(rw, buf); err != nil || string(buf) != prefaceRest {
+		return
+	}
+	tc.SetDeadline(time.Time{})
+
+	h2s.ServeConn(&rawBufConn{rawTLSConn: tc, r: rw.Reader}, &http2.ServeConnOpts{
+		Context:          r.Context(),
+		Handler:          h,
+		BaseConfig:       srv,
+		SawClientPreface: true,
+	})
+}
+
+// captureRaw is a middleware, which takes the captured request from the connection.
+// Every request takes its record, so records of the connection are kept in order.
+func captureRaw(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if rc, ok := r.Context().Value(rawConnKey{}).(*rawConn); ok {
+			if raw := rc.request(r); raw != nil {
+				r = r.WithContext(context.WithValue(r.Context(), rawRequestKey{}, raw))
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// getRawRequest returns the request as it was received on the wire, or nil if it was not captured.
+func getRawRequest(r *http.Request) *RawRequest {
+	raw, _ := r.Context().Value(rawRequestKey{}).(*RawRequest)
+	return raw
+}
+
+// RawHandle returns the request line and header fields as they were received on the wire:
+// with the original case, order and duplicates for HTTP/1.x, and in the decoded HEADERS order for HTTP/2.
+// It returns 501 if the request was not captured, see `NewRawListener` and `ConfigureRawCapture`.
+func RawHandle(w http.ResponseWriter, r *http.Request) {
+	raw := getRawRequest(r)
+	if raw == nil {
+		RenderError(w, "the request was not captured, the server must use NewRawListener and ConfigureRawCapture",
+			http.StatusNotImplemented)
+		return
+	}
+	RenderResponse(w, http.StatusOK, raw)
+}
@@ -0,0 +1,251 @@
+package httpbulb
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/http2"
+)
+
+type RawSuite struct {
+	suite.Suite
+	testServer    *httptest.Server
+	testTLSServer *httptest.Server
+	tlsURL        string
+	ca            *CertAuthority
+}
+
+func (s *RawSuite) SetupSuite() {
+	s.testServer = httptest.NewUnstartedServer(NewH2CHandler(NewRouter()))
+	s.testServer.Listener = NewRawListener(s.testServer.Listener)
+	s.Require().NoError(ConfigureRawCapture(s.testServer.Config))
+	s.testServer.Start()
+
+	var err error
+	s.ca, err = NewCertAuthority("httpbulb test CA")
+	s.Require().NoError(err)
+	cert, err := s.ca.IssueServerCert(ServerCertOptions{Hosts: []string{"127.0.0.1"}})
+	s.Require().NoError(err)
+
+	// the TLS listener records both HTTP/1.1 and HTTP/2 in the plain text
+	s.testTLSServer = httptest.NewUnstartedServer(NewRouter())
+	s.testTLSServer.Config.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.Require().NoError(ConfigureRawCapture(s.testTLSServer.Config))
+	s.testTLSServer.Listener = NewRawTLSListener(s.testTLSServer.Listener, s.testTLSServer.Config.TLSConfig)
+	s.testTLSServer.Start()
+	s.tlsURL = "https://" + s.testTLSServer.Listener.Addr().String()
+}
+
+func (s *RawSuite) TearDownSuite() {
+	s.testServer.Close()
+	s.testTLSServer.Close()
+}
+
+func (s *RawSuite) TestHTTP1() {
+	u, err := url.Parse(s.testServer.URL)
+	s.Require().NoError(err)
+
+	conn, err := net.DialTimeout("tcp", u.Host, 10*time.Second)
+	s.Require().NoError(err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	br := bufio.NewReader(conn)
+
+	// pipelined requests on the same connection, the first one has a body
+	first := "POST /anything?a=1 HTTP/1.1\r\nhost: " + u.Host + "\r\nx-lower: 1\r\nX-Dup: a\r\nX-UPPER: 2\r\n" +
+		"X-Dup: b\r\nContent-Length: 32\r\n\r\nGET /raw HTTP/1.1\r\nX-Fake: 1\r\n\r\n"
+	second := "GET /raw HTTP/1.1\nHost: " + u.Host + "\nX-Folded: a\n  b\n\n"
+	_, err = fmt.Fprint(conn, first+second)
+	s.Require().NoError(err)
+
+	resp, err := http.ReadResponse(br, nil)
+	s.Require().NoError(err)
+	result := &MethodsResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	resp.Body.Close()
+
+	s.Require().NotNil(result.Raw)
+	s.Require().Equal("POST /anything?a=1 HTTP/1.1", result.Raw.RequestLine)
+	s.Require().Equal([]RawHeader{
+		{Name: "host", Value: u.Host},
+		{Name: "x-lower", Value: "1"},
+		{Name: "X-Dup", Value: "a"},
+		{Name: "X-UPPER", Value: "2"},
+		{Name: "X-Dup", Value: "b"},
+		{Name: "Content-Length", Value: "32"},
+	}, result.Raw.Headers)
+	s.Require().Equal(first[:len(first)-32], result.Raw.Raw)
+
+	resp, err = http.ReadResponse(br, nil)
+	s.Require().NoError(err)
+	raw := &RawRequest{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(raw))
+	resp.Body.Close()
+
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("HTTP/1.1", raw.Proto)
+	s.Require().Equal(second, raw.Raw)
+	s.Require().Equal([]RawHeader{{Name: "Host", Value: u.Host}, {Name: "X-Folded", Value: "a b"}}, raw.Headers)
+}
+
+func (s *RawSuite) TestH2C() {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	// the second request on the connection uses the HPACK dynamic table
+	for i := 0; i < 2; i++ {
+		raw := s.getRaw(client, s.testServer.URL)
+		s.Require().Equal("HTTP/2.0", raw.Proto)
+		s.Require().Empty(raw.RequestLine)
+		s.Require().Equal([]RawHeader{
+			{Name: ":authority", Value: s.testServer.Listener.Addr().String()},
+			{Name: ":method", Value: "GET"},
+			{Name: ":path", Value: "/raw?n=1"},
+			{Name: ":scheme", Value: "http"},
+		}, raw.Headers[:4])
+
+		var values []string
+		for _, h := range raw.Headers {
+			if h.Name == "x-a" {
+				values = append(values, h.Value)
+			}
+		}
+		s.Require().Equal([]string{"1", "3"}, values)
+	}
+}
+
+func (s *RawSuite) TestHTTP2TLS() {
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: s.ca.Pool()},
+		ForceAttemptHTTP2: true,
+	}}
+
+	// the second request on the connection uses the HPACK dynamic table
+	for i := 0; i < 2; i++ {
+		raw := s.getRaw(client, s.tlsURL)
+		s.Require().Equal("HTTP/2.0", raw.Proto)
+		s.Require().Equal(":scheme", raw.Headers[3].Name)
+		s.Require().Equal("https", raw.Headers[3].Value)
+	}
+
+	s.requireTLSState(client)
+}
+
+func (s *RawSuite) TestHTTP1TLS() {
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: s.ca.Pool()},
+	}}
+
+	raw := s.getRaw(client, s.tlsURL)
+	s.Require().Equal("HTTP/1.1", raw.Proto)
+	s.Require().Equal("GET /raw?n=1 HTTP/1.1", raw.RequestLine)
+
+	var values []string
+	for _, h := range raw.Headers {
+		if h.Name == "x-a" {
+			values = append(values, h.Value)
+		}
+	}
+	s.Require().Equal([]string{"1", "3"}, values)
+
+	s.requireTLSState(client)
+}
+
+// requireTLSState checks that handlers get the TLS state of connections of the TLS listener.
+func (s *RawSuite) requireTLSState(client *http.Client) {
+	resp, err := client.Get(s.tlsURL + "/get")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	result := &MethodsResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	s.Require().Equal(s.tlsURL+"/get", result.URL)
+	s.Require().Equal(resp.Proto, result.Raw.Proto)
+}
+
+func (s *RawSuite) TestNotCaptured() {
+	ts := httptest.NewServer(NewRouter())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/raw")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusNotImplemented, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/get")
+	s.Require().NoError(err)
+	result := map[string]interface{}{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	s.Require().NotContains(result, "raw")
+}
+
+func (s *RawSuite) getRaw(client *http.Client, baseURL string) *RawRequest {
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/raw?n=1", nil)
+	s.Require().NoError(err)
+	req.Header["x-a"] = []string{"1", "3"}
+
+	resp, err := client.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	raw := &RawRequest{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(raw))
+	return raw
+}
+
+func TestRawSuite(t *testing.T) {
+	suite.Run(t, new(RawSuite))
+}
+
+func TestRawH2Parser(t *testing.T) {
+	// a header block split into HEADERS (padded, with priority) and CONTINUATION frames
+	p := newRawH2Parser()
+	block := []byte{0x82, 0x84, 0x86, 0x41, 0x0f, 'w', 'w', 'w', '.', 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm'}
+	headers := append([]byte{2}, []byte{0, 0, 0, 0, 16}...)
+	headers = append(append(headers, block[:3]...), 0, 0)
+	// a DATA frame of another stream is skipped
+	frames := []byte{0, 0, 2, 0, 0, 0, 0, 0, 3, 'h', 'i'}
+	frames = append(frames, 0, 0, byte(len(headers)), h2FrameHeaders, h2FlagPadded|h2FlagPriority, 0, 0, 0, 5)
+	frames = append(frames, headers...)
+	frames = append(frames, 0, 0, byte(len(block)-3), h2FrameContinuation, h2FlagEndHeaders, 0, 0, 0, 5)
+	frames = append(frames, block[3:]...)
+
+	// frames are split between reads
+	for _, b := range frames {
+		p.write([]byte{b})
+	}
+	require.False(t, p.failed)
+	require.Len(t, p.streams, 1)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	raw := p.request(r)
+	require.NotNil(t, raw)
+	require.Equal(t, []RawHeader{
+		{Name: ":method", Value: "GET"}, {Name: ":path", Value: "/"}, {Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: "www.example.com"},
+	}, raw.Headers)
+	require.Equal(t, uint32(5), raw.StreamID)
+	require.Empty(t, p.streams)
+}
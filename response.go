@@ -2,16 +2,21 @@ package httpbulb
 
 import (
 	"net/http"
+	"time"
 )
 
 // MethodsResponse is the response for the methods endpoint
 type MethodsResponse struct {
 	// Args is a map of query parameters
 	Args map[string][]string `json:"args"`
+	// ArgsList is a list of query parameters in the order they were sent
+	ArgsList []QueryArg `json:"args_list"`
+	// RawQuery is the query string as it was sent, without `?`
+	RawQuery string `json:"raw_query"`
 	// Data is the raw body of the request
 	Data string `json:"data"`
 	// Files is a map of files sent in the request
-	Files map[string][]string `json:"files"`
+	Files map[string][]FileInfo `json:"files"`
 	// Form is a map of form values sent in the request
 	Form map[string][]string `json:"form"`
 	// Headers is a map of headers sent in the request
@@ -30,6 +35,96 @@ type MethodsResponse struct {
 	Deflated bool `json:"deflated,omitempty"`
 	// Proto is the protocol of the request
 	Proto string `json:"proto"`
+	// H2C shows how the cleartext HTTP/2 connection was established: `upgrade` or `prior-knowledge`
+	H2C string `json:"h2c,omitempty"`
+	// Raw is the request as it was received on the wire, if the server captures requests (see `NewRawListener`)
+	Raw *RawRequest `json:"raw,omitempty"`
+	// Connection is the connection of the request, if the server tracks connections (see `ConfigureConnTracking`)
+	Connection *ConnectionInfo `json:"connection,omitempty"`
+	// RequestEncoding describes the compressed request body, if it was sent with `Content-Encoding`
+	RequestEncoding *RequestEncoding `json:"request_encoding,omitempty"`
+}
+
+// RequestEncoding describes the request body, which was decompressed by the server.
+type RequestEncoding struct {
+	// Encoding is the content coding of the request body, e.g. `gzip` or `gzip, br` if several codings were applied
+	Encoding string `json:"encoding"`
+	// CompressedSize is the size of the body as it was sent
+	CompressedSize int64 `json:"compressed_size"`
+	// DecompressedSize is the size of the decoded body
+	DecompressedSize int64 `json:"decompressed_size"`
+}
+
+// ConnectionInfo is the response for the connection endpoint.
+type ConnectionInfo struct {
+	// ID is the connection identifier, unique for the server
+	ID uint64 `json:"id"`
+	// Request is the number of the request on the connection, starting from 1
+	Request int64 `json:"request"`
+	// Reused is true if the connection served requests before
+	Reused bool `json:"reused"`
+	// LocalAddr is the server address of the connection
+	LocalAddr string `json:"local_addr"`
+	// RemoteAddr is the client address of the connection
+	RemoteAddr string `json:"remote_addr"`
+	// Proto is the protocol of the request
+	Proto string `json:"proto"`
+	// StreamID is the HTTP/2 stream identifier, if requests are captured (see `NewRawListener`)
+	StreamID uint32 `json:"stream_id,omitempty"`
+	// ConnectedAt is the time the connection was accepted
+	ConnectedAt time.Time `json:"connected_at"`
+	// OpenConnections is the number of open connections of the server
+	OpenConnections int64 `json:"open_connections"`
+}
+
+// FileInfo describes a file uploaded in a multipart form.
+type FileInfo struct {
+	// Filename is the file name of the part
+	Filename string `json:"filename"`
+	// ContentType is the content type declared in the part
+	ContentType string `json:"content_type"`
+	// Size is the file size in bytes
+	Size int64 `json:"size"`
+	// SHA256 is the hex-encoded SHA-256 of the file content
+	SHA256 string `json:"sha256"`
+	// Headers are the part headers
+	Headers map[string][]string `json:"headers"`
+	// Content is the file content as a base64 data URL, if the file size doesn't exceed `Config.MultipartContentLimit`
+	Content string `json:"content,omitempty"`
+}
+
+// QueryArg is a query parameter of the request.
+type QueryArg struct {
+	// Key is the unescaped key
+	Key string `json:"key"`
+	// Value is the unescaped value, it is empty for keys without `=`
+	Value string `json:"value"`
+	// Raw is the parameter as it was sent
+	Raw string `json:"raw"`
+}
+
+// RawRequest is the response for the raw endpoint.
+// It contains the request line and header fields as they were received on the wire.
+type RawRequest struct {
+	// Proto is the protocol of the request
+	Proto string `json:"proto"`
+	// RequestLine is the request line of HTTP/1.x request
+	RequestLine string `json:"request_line,omitempty"`
+	// StreamID is the HTTP/2 stream identifier
+	StreamID uint32 `json:"stream_id,omitempty"`
+	// Headers are header fields in the received order with the original case and duplicates,
+	// HTTP/2 pseudo-header fields are included
+	Headers []RawHeader `json:"headers"`
+	// Raw is the HTTP/1.x request head (the request line, header fields and the empty line) as is
+	Raw string `json:"raw,omitempty"`
+}
+
+// RawHeader is a header field of the raw request.
+type RawHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Sensitive is true if the HTTP/2 header field must never be indexed
+	Sensitive bool `json:"sensitive,omitempty"`
 }
 
 // StatusResponse is the response for the status endpoint
@@ -59,18 +154,190 @@ type AuthResponse struct {
 	Token         string `json:"token,omitempty"`
 }
 
+// APIKeyResponse is the response for the api-key endpoints
+type APIKeyResponse struct {
+	Authenticated bool `json:"authenticated"`
+	// In is the location of the key: header, query or cookie
+	In string `json:"in"`
+	// Name is the name of the header, query parameter or cookie
+	Name string `json:"name"`
+}
+
+// SessionResponse is the response for the `/session` endpoint
+type SessionResponse struct {
+	Authenticated bool      `json:"authenticated"`
+	User          string    `json:"user"`
+	Expires       time.Time `json:"expires"`
+}
+
+// JWTResponse is the response for the bearer jwt endpoint
+type JWTResponse struct {
+	Authenticated bool `json:"authenticated"`
+	// Header is the decoded JOSE header of the token
+	Header map[string]interface{} `json:"header"`
+	// Claims are the decoded claims of the token
+	Claims map[string]interface{} `json:"claims"`
+}
+
+// SigV4Response is the response for the `/aws-sigv4` endpoint
+type SigV4Response struct {
+	Authenticated   bool     `json:"authenticated"`
+	AccessKey       string   `json:"access_key"`
+	Region          string   `json:"region"`
+	Service         string   `json:"service"`
+	CredentialScope string   `json:"credential_scope"`
+	Presigned       bool     `json:"presigned"`
+	SignedHeaders   []string `json:"signed_headers"`
+	// CanonicalRequest, StringToSign and ExpectedSignature are computed by the server
+	CanonicalRequest  string `json:"canonical_request,omitempty"`
+	StringToSign      string `json:"string_to_sign,omitempty"`
+	ExpectedSignature string `json:"expected_signature,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// HTTPSignatureResponse is the response for the `/http-signature` endpoint
+type HTTPSignatureResponse struct {
+	Authenticated bool                  `json:"authenticated"`
+	Signatures    []HTTPSignatureResult `json:"signatures"`
+	// Error is the error of `Content-Digest` check
+	Error string `json:"error,omitempty"`
+}
+
+// HTTPSignatureResult is the verification result of a single HTTP message signature
+type HTTPSignatureResult struct {
+	Label      string   `json:"label"`
+	KeyID      string   `json:"keyid,omitempty"`
+	Algorithm  string   `json:"alg,omitempty"`
+	Components []string `json:"components"`
+	Created    int64    `json:"created,omitempty"`
+	Expires    int64    `json:"expires,omitempty"`
+	// SignatureBase is computed by the server
+	SignatureBase string `json:"signature_base"`
+	Verified      bool   `json:"verified"`
+	Error         string `json:"error,omitempty"`
+}
+
+// TLSResponse is the response for the `/tls` endpoint
+type TLSResponse struct {
+	// Version is the TLS version, e.g. `TLS 1.3`
+	Version string `json:"version"`
+	// CipherSuite is the name of the negotiated cipher suite
+	CipherSuite string `json:"cipher_suite"`
+	// NegotiatedProtocol is the ALPN protocol, e.g. `h2`
+	NegotiatedProtocol string `json:"negotiated_protocol"`
+	// ServerName is the server name sent by the client (SNI)
+	ServerName string `json:"server_name"`
+	// DidResume is true if the session was resumed
+	DidResume bool `json:"did_resume"`
+	// ECHAccepted shows if Encrypted Client Hello was accepted, it is absent if ECH is not supported
+	ECHAccepted *bool `json:"ech_accepted,omitempty"`
+	// ClientCertificates is the number of certificates presented by the client
+	ClientCertificates int `json:"client_certificates"`
+}
+
+// CertificateInfo describes an X.509 certificate
+type CertificateInfo struct {
+	Subject        string    `json:"subject"`
+	Issuer         string    `json:"issuer"`
+	SerialNumber   string    `json:"serial_number"`
+	NotBefore      time.Time `json:"not_before"`
+	NotAfter       time.Time `json:"not_after"`
+	DNSNames       []string  `json:"dns_names,omitempty"`
+	EmailAddresses []string  `json:"email_addresses,omitempty"`
+	IPAddresses    []string  `json:"ip_addresses,omitempty"`
+	URIs           []string  `json:"uris,omitempty"`
+	IsCA           bool      `json:"is_ca"`
+}
+
+// ClientCertResponse is the response for the `/tls/client-cert` endpoint
+type ClientCertResponse struct {
+	// Presented is true if the client sent a certificate
+	Presented bool `json:"presented"`
+	// Verified is true if the chain is verified with the client CA
+	Verified bool `json:"verified"`
+	// VerifyError is the reason why the chain is not verified
+	VerifyError string `json:"verify_error,omitempty"`
+	// Chain is the presented certificate chain, the leaf certificate goes first
+	Chain []CertificateInfo `json:"chain"`
+}
+
+// OAuthTokenResponse is the response for the oauth token endpoint
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuthErrorResponse is the error response of oauth endpoints (RFC 6749, section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthDeviceCodeResponse is the response for the device authorization endpoint (RFC 8628)
+type OAuthDeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// OAuthDeviceVerifyResponse is the response for the device verification endpoint
+type OAuthDeviceVerifyResponse struct {
+	Approved bool   `json:"approved"`
+	UserCode string `json:"user_code"`
+}
+
+// OAuthUserinfoResponse is the response for the userinfo endpoint
+type OAuthUserinfoResponse struct {
+	Sub               string `json:"sub"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+}
+
+// OIDCDiscoveryResponse is the OpenID Connect discovery document
+type OIDCDiscoveryResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
 // StreamResponse represents a response for the stream endpoint
 type StreamResponse struct {
 	// ID is the ID of the message
 	ID int `json:"id"`
 	// Args is a map of query parameters
 	Args map[string][]string `json:"args"`
+	// ArgsList is a list of query parameters in the order they were sent
+	ArgsList []QueryArg `json:"args_list"`
+	// RawQuery is the query string as it was sent, without `?`
+	RawQuery string `json:"raw_query"`
 	// Data is the raw body of the request
 	Headers map[string][]string `json:"headers"`
 	// Origin is the IP address of the requester
 	Origin string `json:"origin"`
 	// URL is the full URL of the request
 	URL string `json:"url"`
+	// Padding is a filler to increase the message size, see `padding` query parameter
+	Padding string `json:"padding,omitempty"`
 }
 
 // CookiesResponse represents a response for the cookies endpoint
@@ -79,6 +346,33 @@ type CookiesResponse struct {
 	Cookies map[string][]string `json:"cookies"`
 }
 
+// SetCookiesResponse represents a response for the cookies/set-noredirect endpoints.
+// It contains the values of Set-Cookie headers.
+type SetCookiesResponse struct {
+	SetCookie []string `json:"set_cookie"`
+}
+
+// SignedCookiesResponse represents a response for the cookies/signed/verify endpoint.
+// Valid is true if there are signed cookies and all of them are valid.
+type SignedCookiesResponse struct {
+	Valid   bool                 `json:"valid"`
+	Cookies []SignedCookieResult `json:"cookies"`
+}
+
+// SignedCookieResult is the verification result of a cookie.
+// Status is one of: valid, tampered, expired, replayed, unsigned.
+type SignedCookieResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Mode     string `json:"mode,omitempty"`
+	Value    string `json:"value,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Once     bool   `json:"once,omitempty"`
+	IssuedAt int64  `json:"issued_at,omitempty"`
+	Expires  int64  `json:"expires,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
 // CookiesListResponse represents a response for the cookies-list endpoint.
 // In this case, cookies are represented as a list (slice) of `http.Cookie`.
 type CookiesListResponse struct {
@@ -90,6 +384,27 @@ type UUIDResponse struct {
 	UUID string `json:"uuid"`
 }
 
+// PollMessage represents a message published to a long-polling channel.
+type PollMessage struct {
+	// Seq is the sequence number of the message in the channel
+	Seq uint64 `json:"seq"`
+	// Data is the published data
+	Data string `json:"data"`
+	// Time is the publication time
+	Time time.Time `json:"time"`
+}
+
+// PollResponse represents a response for the poll endpoint.
+type PollResponse struct {
+	Channel string `json:"channel"`
+	// Cursor is the sequence number of the last message in the response,
+	// it should be sent with the next request to resume polling
+	Cursor uint64 `json:"cursor"`
+	// Missed is the number of messages which were dropped from the channel buffer before they were received
+	Missed   uint64        `json:"missed,omitempty"`
+	Messages []PollMessage `json:"messages"`
+}
+
 //	ErrorResponse represents an error response from the server.
 //
 // It is used to return errors in JSON format.
@@ -0,0 +1,326 @@
+package httpbulb
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName    = "bulb_session"
+	sessionCSRFCookie    = "bulb_csrf"
+	sessionCSRFField     = "csrf_token"
+	sessionCSRFTTL       = 10 * time.Minute
+	sessionDefaultTTL    = time.Hour
+	sessionDefaultUser   = "user"
+	sessionDefaultPasswd = "passwd"
+	sessionLoginPath     = "/login"
+	sessionDefaultNext   = "/protected"
+	// sessionMaxEntries limits the number of kept sessions and CSRF tokens each, the oldest ones are dropped first
+	sessionMaxEntries = 10000
+)
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Login</title></head>
+<body>
+<h1>Login</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/login">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="next" value="{{.Next}}">
+<label>Username <input type="text" name="username" autocomplete="username"></label>
+<label>Password <input type="password" name="password" autocomplete="current-password"></label>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+var protectedTemplate = template.Must(template.New("protected").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Protected</title></head>
+<body>
+<h1>Hello, <span id="user">{{.User}}</span>!</h1>
+<p>You are viewing <code>{{.Path}}</code>.</p>
+<ul>
+<li><a href="/protected">Protected</a></li>
+<li><a href="/protected/profile">Profile</a></li>
+<li><a href="/protected/settings">Settings</a></li>
+</ul>
+<form method="post" action="/logout"><button type="submit">Log out</button></form>
+</body>
+</html>
+`))
+
+// SessionStore keeps login sessions and CSRF tokens of the `/login` flow.
+// The session id is sent in a cookie signed with a random secret, the session state is kept on the server.
+//
+// A zero SessionStore is usable: the signing secret is generated on the first use and zero `TTL` means one hour.
+// Sessions and tokens are guarded by a mutex, so the store can be shared by concurrent requests,
+// `Users` and `TTL` are only read and must not be changed while the store is in use.
+// The store keeps up to 10000 sessions and 10000 CSRF tokens, the oldest ones are dropped first.
+type SessionStore struct {
+	// Users maps usernames to passwords. If empty, only `user` with password `passwd` can log in.
+	Users map[string]string
+	// TTL is the lifetime of a session. Default is one hour.
+	TTL time.Duration
+
+	secret     []byte
+	secretOnce sync.Once
+	mu         sync.Mutex
+	csrfTokens map[string]time.Time
+	sessions   map[string]*loginSession
+	// csrfOrder and sessionOrder keep ids in the order they were issued, which is also the order they expire
+	csrfOrder    []string
+	sessionOrder []string
+}
+
+type loginSession struct {
+	user    string
+	expires time.Time
+}
+
+// NewSessionStore returns a new SessionStore with a random signing secret.
+func NewSessionStore() *SessionStore {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return &SessionStore{
+		TTL:    sessionDefaultTTL,
+		secret: secret,
+	}
+}
+
+// checkCredentials reports whether the user can log in with the password.
+func (s *SessionStore) checkCredentials(user, passwd string) bool {
+	users := s.Users
+	if len(users) == 0 {
+		users = map[string]string{sessionDefaultUser: sessionDefaultPasswd}
+	}
+	expected, ok := users[user]
+	return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(passwd)) == 1
+}
+
+// newCSRFToken issues a one-time CSRF token.
+func (s *SessionStore) newCSRFToken() string {
+	token := randomToken(24)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.csrfTokens == nil {
+		s.csrfTokens = make(map[string]time.Time)
+	}
+	// only the oldest tokens are visited, used tokens are already deleted from the map
+	for len(s.csrfOrder) > 0 {
+		oldest := s.csrfOrder[0]
+		if expires, ok := s.csrfTokens[oldest]; ok && !now.After(expires) && len(s.csrfOrder) < sessionMaxEntries {
+			break
+		}
+		delete(s.csrfTokens, oldest)
+		s.csrfOrder = s.csrfOrder[1:]
+	}
+	s.csrfTokens[token] = now.Add(sessionCSRFTTL)
+	s.csrfOrder = append(s.csrfOrder, token)
+	return token
+}
+
+// useCSRFToken checks that the token was issued and is not expired, the token can be used only once.
+func (s *SessionStore) useCSRFToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.csrfTokens[token]
+	delete(s.csrfTokens, token)
+	return ok && time.Now().Before(expires)
+}
+
+// create starts a new session and returns the signed cookie value.
+func (s *SessionStore) create(user string) (value string, expires time.Time) {
+	id := randomToken(24)
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = sessionDefaultTTL
+	}
+	now := time.Now()
+	expires = now.Add(ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*loginSession)
+	}
+	// only the oldest sessions are visited, ended sessions are already deleted from the map
+	for len(s.sessionOrder) > 0 {
+		oldest := s.sessionOrder[0]
+		if session, ok := s.sessions[oldest]; ok && !now.After(session.expires) && len(s.sessionOrder) < sessionMaxEntries {
+			break
+		}
+		delete(s.sessions, oldest)
+		s.sessionOrder = s.sessionOrder[1:]
+	}
+	s.sessions[id] = &loginSession{user: user, expires: expires}
+	s.sessionOrder = append(s.sessionOrder, id)
+	return id + "." + s.sign(id), expires
+}
+
+// get returns the session of the signed cookie value.
+func (s *SessionStore) get(value string) (id string, session *loginSession, ok bool) {
+	id, signature, found := strings.Cut(value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(s.sign(id))) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok = s.sessions[id]
+	if ok && time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return "", nil, false
+	}
+	return
+}
+
+// delete ends the session.
+func (s *SessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+func (s *SessionStore) sign(id string) string {
+	s.secretOnce.Do(func() {
+		if s.secret == nil {
+			s.secret = make([]byte, 32)
+			if _, err := rand.Read(s.secret); err != nil {
+				panic(err)
+			}
+		}
+	})
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sessionNext returns the local path to redirect after login, absolute and protocol-relative URLs are rejected.
+func sessionNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return sessionDefaultNext
+	}
+	return next
+}
+
+func renderLoginForm(w http.ResponseWriter, r *http.Request, store *SessionStore, next, errMsg string, status int) {
+	token := store.newCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCSRFCookie,
+		Value:    token,
+		Path:     sessionLoginPath,
+		HttpOnly: true,
+		Secure:   getURLScheme(r) == schemeHttps,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	loginTemplate.Execute(w, struct {
+		CSRFToken string
+		Next      string
+		Error     string
+	}{token, sessionNext(next), errMsg})
+}
+
+// LoginFormHandle serves the HTML login form with a CSRF token.
+// The token is embedded in the form and set in a cookie, the form is posted to `LoginHandle`.
+// `next` query parameter is the local path to redirect after login, default is `/protected`.
+func LoginFormHandle(w http.ResponseWriter, r *http.Request) {
+	renderLoginForm(w, r, getConfig(r).Sessions, r.URL.Query().Get("next"), "", http.StatusOK)
+}
+
+// LoginHandle validates the CSRF token and the credentials posted by the login form.
+// On success it sets a signed session cookie and redirects (303) to `next`.
+// It returns 403 if the CSRF token is missing, invalid or doesn't match the cookie,
+// and 401 with a new login form if the credentials are wrong.
+func LoginHandle(w http.ResponseWriter, r *http.Request) {
+	store := getConfig(r).Sessions
+
+	if err := r.ParseForm(); err != nil {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	next := r.PostForm.Get("next")
+
+	token := r.PostForm.Get(sessionCSRFField)
+	cookieToken := getCookie(r, sessionCSRFCookie)
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cookieToken)) != 1 || !store.useCSRFToken(token) {
+		RenderError(w, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+
+	user := r.PostForm.Get("username")
+	if !store.checkCredentials(user, r.PostForm.Get("password")) {
+		renderLoginForm(w, r, store, next, "Invalid username or password.", http.StatusUnauthorized)
+		return
+	}
+
+	value, expires := store.create(user)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   getURLScheme(r) == schemeHttps,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{Name: sessionCSRFCookie, Path: sessionLoginPath, MaxAge: -1})
+	http.Redirect(w, r, sessionNext(next), http.StatusSeeOther)
+}
+
+// LogoutHandle ends the session, expires the session cookie and redirects to `/login`.
+func LogoutHandle(w http.ResponseWriter, r *http.Request) {
+	store := getConfig(r).Sessions
+	if id, _, ok := store.get(getCookie(r, sessionCookieName)); ok {
+		store.delete(id)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, sessionLoginPath, http.StatusSeeOther)
+}
+
+// ProtectedHandle serves an HTML page, which requires a login session.
+// Without a valid session it redirects (302) to `/login` with `next` set to the requested page.
+func ProtectedHandle(w http.ResponseWriter, r *http.Request) {
+	store := getConfig(r).Sessions
+	_, session, ok := store.get(getCookie(r, sessionCookieName))
+	if !ok {
+		http.Redirect(w, r, sessionLoginPath+"?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	protectedTemplate.Execute(w, struct {
+		User string
+		Path string
+	}{session.user, r.URL.Path})
+}
+
+// SessionHandle returns the current login session, it returns 401 without a valid session.
+func SessionHandle(w http.ResponseWriter, r *http.Request) {
+	store := getConfig(r).Sessions
+	_, session, ok := store.get(getCookie(r, sessionCookieName))
+	if !ok {
+		RenderError(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+	RenderResponse(w, http.StatusOK, SessionResponse{Authenticated: true, User: session.user, Expires: session.expires})
+}
@@ -0,0 +1,275 @@
+package httpbulb
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+var csrfTokenInput = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+type SessionSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+}
+
+func (s *SessionSuite) SetupSuite() {
+	sessions := NewSessionStore()
+	sessions.Users = map[string]string{"alice": "wonderland"}
+	s.testServer = httptest.NewServer(NewRouterWithConfig(Config{Sessions: sessions}))
+}
+
+func (s *SessionSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+// newClient returns a client with a cookie jar, like a browser.
+func (s *SessionSuite) newClient() *http.Client {
+	jar, err := cookiejar.New(nil)
+	s.Require().NoError(err)
+	return &http.Client{Jar: jar}
+}
+
+// loginForm follows redirects to the login form and returns the CSRF token and the page.
+func (s *SessionSuite) loginForm(client *http.Client, path string) (token string, body string) {
+	resp, err := client.Get(s.testServer.URL + path)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("/login", resp.Request.URL.Path)
+
+	data, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	m := csrfTokenInput.FindStringSubmatch(string(data))
+	s.Require().Len(m, 2)
+	return m[1], string(data)
+}
+
+func (s *SessionSuite) TestLoginFlow() {
+	client := s.newClient()
+
+	// the protected page redirects to the login form
+	token, body := s.loginForm(client, "/protected/profile?tab=1")
+	s.Require().Contains(body, `name="next" value="/protected/profile?tab=1"`)
+
+	resp, err := client.PostForm(s.testServer.URL+"/login", url.Values{
+		"csrf_token": {token},
+		"next":       {"/protected/profile?tab=1"},
+		"username":   {"alice"},
+		"password":   {"wonderland"},
+	})
+	s.Require().NoError(err)
+	data, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	resp.Body.Close()
+
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("/protected/profile", resp.Request.URL.Path)
+	s.Require().Contains(string(data), `<span id="user">alice</span>`)
+
+	resp, err = client.Get(s.testServer.URL + "/session")
+	s.Require().NoError(err)
+	session := &SessionResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(session))
+	resp.Body.Close()
+	s.Require().True(session.Authenticated)
+	s.Require().Equal("alice", session.User)
+
+	// logout ends the session on the server, the old cookie is not accepted anymore
+	u, _ := url.Parse(s.testServer.URL)
+	oldCookies := client.Jar.Cookies(u)
+
+	// a cross-site GET can't end the session
+	resp, err = client.Get(s.testServer.URL + "/logout")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = client.PostForm(s.testServer.URL+"/logout", nil)
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal("/login", resp.Request.URL.Path)
+
+	replay, err := http.NewRequest(http.MethodGet, s.testServer.URL+"/session", nil)
+	s.Require().NoError(err)
+	for _, c := range oldCookies {
+		replay.AddCookie(c)
+	}
+	resp, err = http.DefaultClient.Do(replay)
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (s *SessionSuite) TestLogin() {
+	type testArgs struct {
+		name           string
+		form           func(token string) url.Values
+		noCookie       bool
+		reuseToken     bool
+		wantStatusCode int
+		wantLocation   string
+	}
+
+	tests := []testArgs{
+		{
+			name: "valid credentials",
+			form: func(token string) url.Values {
+				return url.Values{"csrf_token": {token}, "username": {"alice"}, "password": {"wonderland"}}
+			},
+			wantStatusCode: http.StatusSeeOther, wantLocation: "/protected",
+		},
+		{
+			name: "external next is ignored",
+			form: func(token string) url.Values {
+				return url.Values{"csrf_token": {token}, "username": {"alice"}, "password": {"wonderland"},
+					"next": {"//evil.example/"}}
+			},
+			wantStatusCode: http.StatusSeeOther, wantLocation: "/protected",
+		},
+		{
+			name: "wrong password",
+			form: func(token string) url.Values {
+				return url.Values{"csrf_token": {token}, "username": {"alice"}, "password": {"wrong"}}
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "missing CSRF token",
+			form: func(string) url.Values {
+				return url.Values{"username": {"alice"}, "password": {"wonderland"}}
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "forged CSRF token",
+			form: func(string) url.Values {
+				return url.Values{"csrf_token": {"forged"}, "username": {"alice"}, "password": {"wonderland"}}
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "CSRF token without cookie",
+			form: func(token string) url.Values {
+				return url.Values{"csrf_token": {token}, "username": {"alice"}, "password": {"wonderland"}}
+			},
+			noCookie:       true,
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "reused CSRF token",
+			form: func(token string) url.Values {
+				return url.Values{"csrf_token": {token}, "username": {"alice"}, "password": {"wonderland"}}
+			},
+			reuseToken:     true,
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			client := s.newClient()
+			client.CheckRedirect = func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}
+			token, _ := s.loginForm(s.newClient(), "/login")
+			if !tt.noCookie {
+				token, _ = s.loginForm(client, "/login")
+			}
+
+			post := func() *http.Response {
+				resp, err := client.Post(s.testServer.URL+"/login", "application/x-www-form-urlencoded",
+					strings.NewReader(tt.form(token).Encode()))
+				require.NoError(t, err)
+				resp.Body.Close()
+				return resp
+			}
+
+			resp := post()
+			if tt.reuseToken {
+				require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+				resp = post()
+			}
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			if tt.wantLocation != "" {
+				require.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+			}
+		})
+	}
+}
+
+func (s *SessionSuite) TestProtected() {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	req, err := http.NewRequest(http.MethodGet, s.testServer.URL+"/protected/settings", nil)
+	s.Require().NoError(err)
+	// a session cookie with an invalid signature
+	req.AddCookie(&http.Cookie{Name: "bulb_session", Value: "id.signature"})
+
+	resp, err := client.Do(req)
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusFound, resp.StatusCode)
+	s.Require().Equal("/login?next=%2Fprotected%2Fsettings", resp.Header.Get("Location"))
+
+	resp, err = client.Get(s.testServer.URL + "/session")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestSessionSuite(t *testing.T) {
+	suite.Run(t, new(SessionSuite))
+}
+
+func TestSessionStoreZeroValue(t *testing.T) {
+	store := &SessionStore{Users: map[string]string{"alice": "wonderland"}}
+
+	token := store.newCSRFToken()
+	require.True(t, store.useCSRFToken(token))
+	require.False(t, store.useCSRFToken(token))
+
+	value, expires := store.create("alice")
+	require.NotEmpty(t, store.secret)
+	require.WithinDuration(t, time.Now().Add(sessionDefaultTTL), expires, time.Minute)
+
+	_, session, ok := store.get(value)
+	require.True(t, ok)
+	require.Equal(t, "alice", session.user)
+}
+
+func TestSessionStoreLimit(t *testing.T) {
+	store := &SessionStore{}
+
+	// the oldest sessions and tokens are dropped when the store is full
+	first, _ := store.create("user")
+	token := store.newCSRFToken()
+	for i := 0; i < sessionMaxEntries; i++ {
+		store.create("user")
+		store.newCSRFToken()
+	}
+	require.Len(t, store.sessions, sessionMaxEntries)
+	require.Len(t, store.csrfTokens, sessionMaxEntries)
+	_, _, ok := store.get(first)
+	require.False(t, ok)
+	require.False(t, store.useCSRFToken(token))
+
+	// expired sessions are dropped by the next login
+	store = &SessionStore{TTL: 10 * time.Millisecond}
+	store.create("user")
+	time.Sleep(20 * time.Millisecond)
+	store.create("user")
+	require.Len(t, store.sessions, 1)
+}
@@ -0,0 +1,338 @@
+package httpbulb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes of signed cookies.
+const (
+	SignedCookieModeSigned    = "signed"
+	SignedCookieModeEncrypted = "encrypted"
+)
+
+// Statuses of cookies returned by `/cookies/signed/verify`.
+const (
+	SignedCookieValid    = "valid"
+	SignedCookieTampered = "tampered"
+	SignedCookieExpired  = "expired"
+	SignedCookieReplayed = "replayed"
+	SignedCookieUnsigned = "unsigned"
+)
+
+const (
+	signedCookieDefaultTTL = time.Hour
+	signedCookiePrefix     = "v1."
+	signedCookieSigned     = signedCookiePrefix + "s."
+	signedCookieEncrypted  = signedCookiePrefix + "e."
+)
+
+// signedCookieParams are the query parameters of `/cookies/signed/set`, which are not cookies.
+var signedCookieParams = map[string]bool{"mode": true, "max_age": true, "once": true}
+
+var errSignedCookieTampered = errors.New("signature or encryption doesn't match")
+
+// SignedCookieStore signs and encrypts cookies of `/cookies/signed` endpoints
+// and keeps ids of one-time cookies, which were already verified.
+//
+// A zero SignedCookieStore is usable: a random `Key` is generated on the first use, so cookies don't survive
+// restarts, and zero `TTL` means one hour. The ids of used cookies are guarded by a mutex and dropped once
+// the cookies expire; `Key` and `TTL` must not be changed after the first cookie is issued.
+type SignedCookieStore struct {
+	// Key is the secret to derive the HMAC-SHA256 and AES-256-GCM keys.
+	Key []byte
+	// TTL is the lifetime of one-time cookies without `max_age`. Default is one hour.
+	TTL time.Duration
+
+	keyOnce sync.Once
+	mu      sync.Mutex
+	used    map[string]time.Time
+}
+
+// signedCookiePayload is the JSON payload of a signed or encrypted cookie.
+type signedCookiePayload struct {
+	Value    string `json:"v"`
+	ID       string `json:"id"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp,omitempty"`
+	Once     bool   `json:"once,omitempty"`
+}
+
+// NewSignedCookieStore returns a new SignedCookieStore with a random key.
+func NewSignedCookieStore() *SignedCookieStore {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return &SignedCookieStore{
+		Key: key,
+		TTL: signedCookieDefaultTTL,
+	}
+}
+
+func (s *SignedCookieStore) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return signedCookieDefaultTTL
+	}
+	return s.TTL
+}
+
+// deriveKey returns a key for the purpose, so the same secret is not used by HMAC and AES.
+func (s *SignedCookieStore) deriveKey(purpose string) []byte {
+	s.keyOnce.Do(func() {
+		if len(s.Key) == 0 {
+			s.Key = make([]byte, 32)
+			if _, err := rand.Read(s.Key); err != nil {
+				panic(err)
+			}
+		}
+	})
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte("httpbulb cookie " + purpose))
+	return mac.Sum(nil)
+}
+
+func (s *SignedCookieStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.deriveKey("encryption"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// mac signs the payload bound to the cookie name.
+func (s *SignedCookieStore) mac(name, payload string) []byte {
+	mac := hmac.New(sha256.New, s.deriveKey("signing"))
+	mac.Write([]byte(name + "=" + payload))
+	return mac.Sum(nil)
+}
+
+// encode returns the cookie value with the signed or encrypted payload.
+func (s *SignedCookieStore) encode(name, mode string, payload signedCookiePayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	if mode == SignedCookieModeEncrypted {
+		aead, err := s.aead()
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err = rand.Read(nonce); err != nil {
+			return "", err
+		}
+		sealed := aead.Seal(nonce, nonce, data, []byte(name))
+		return signedCookieEncrypted + base64.RawURLEncoding.EncodeToString(sealed), nil
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return signedCookieSigned + encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(name, encoded)), nil
+}
+
+// decode verifies the cookie value and returns its mode and payload.
+func (s *SignedCookieStore) decode(name, value string) (mode string, payload signedCookiePayload, err error) {
+	var data []byte
+
+	switch {
+	case strings.HasPrefix(value, signedCookieSigned):
+		mode = SignedCookieModeSigned
+		encoded, signature, found := strings.Cut(value[len(signedCookieSigned):], ".")
+		if !found {
+			return mode, payload, errSignedCookieTampered
+		}
+		mac, err := base64.RawURLEncoding.DecodeString(signature)
+		if err != nil || !hmac.Equal(mac, s.mac(name, encoded)) {
+			return mode, payload, errSignedCookieTampered
+		}
+		if data, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return mode, payload, errSignedCookieTampered
+		}
+	case strings.HasPrefix(value, signedCookieEncrypted):
+		mode = SignedCookieModeEncrypted
+		sealed, err := base64.RawURLEncoding.DecodeString(value[len(signedCookieEncrypted):])
+		if err != nil {
+			return mode, payload, errSignedCookieTampered
+		}
+		aead, err := s.aead()
+		if err != nil {
+			return mode, payload, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return mode, payload, errSignedCookieTampered
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if data, err = aead.Open(nil, nonce, ciphertext, []byte(name)); err != nil {
+			return mode, payload, errSignedCookieTampered
+		}
+	default:
+		return "", payload, nil
+	}
+
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return mode, payload, errSignedCookieTampered
+	}
+	return mode, payload, nil
+}
+
+// use marks the one-time cookie as used, it reports false if the cookie was already used.
+func (s *SignedCookieStore) use(id string, expires time.Time) bool {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.used {
+		if now.After(e) {
+			delete(s.used, k)
+		}
+	}
+	if _, ok := s.used[id]; ok {
+		return false
+	}
+	if s.used == nil {
+		s.used = make(map[string]time.Time)
+	}
+	s.used[id] = expires
+	return true
+}
+
+// verify returns the verification result of the cookie.
+func (s *SignedCookieStore) verify(cookie *http.Cookie) SignedCookieResult {
+	result := SignedCookieResult{Name: cookie.Name, Status: SignedCookieUnsigned}
+
+	mode, payload, err := s.decode(cookie.Name, cookie.Value)
+	if mode == "" {
+		return result
+	}
+	result.Mode = mode
+	if err != nil {
+		result.Status, result.Error = SignedCookieTampered, err.Error()
+		return result
+	}
+
+	result.Value, result.ID, result.Once = payload.Value, payload.ID, payload.Once
+	result.IssuedAt, result.Expires = payload.IssuedAt, payload.Expires
+
+	expires := time.Unix(payload.Expires, 0)
+	switch {
+	case payload.Expires != 0 && !time.Now().Before(expires):
+		result.Status, result.Error = SignedCookieExpired, "the cookie expired at "+expires.UTC().Format(time.RFC3339)
+	case payload.Once && !s.use(payload.ID, expires):
+		result.Status, result.Error = SignedCookieReplayed, "the one-time cookie was already verified"
+	default:
+		result.Status = SignedCookieValid
+	}
+	return result
+}
+
+// SetSignedCookiesHandle sets HMAC-signed or AES-GCM-encrypted cookies passed in the query parameters,
+// then redirects to `/cookies/signed/verify`.
+// The key is taken from `Config.SignedCookies`.
+//
+// Query parameters:
+//   - `mode` is `signed` (default) or `encrypted`
+//   - `max_age` is the lifetime in seconds, it is set in the cookie attribute and in the signed payload
+//   - `once` makes the cookies one-time: the second verification reports them as replayed
+func SetSignedCookiesHandle(w http.ResponseWriter, r *http.Request) {
+	store := getConfig(r).SignedCookies
+	params := r.URL.Query()
+
+	mode := params.Get("mode")
+	switch mode {
+	case "":
+		mode = SignedCookieModeSigned
+	case SignedCookieModeSigned, SignedCookieModeEncrypted:
+	default:
+		RenderError(w, "mode must be one of: signed, encrypted", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	once := params.Has("once") && params.Get("once") != "false"
+	maxAge := 0
+	if params.Has("max_age") {
+		var err error
+		if maxAge, err = strconv.Atoi(params.Get("max_age")); err != nil || maxAge <= 0 {
+			RenderError(w, fmt.Sprintf("invalid max_age %q", params.Get("max_age")), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var expires int64
+	if maxAge > 0 {
+		expires = now.Add(time.Duration(maxAge) * time.Second).Unix()
+	} else if once {
+		// one-time cookies always expire, so their ids are not kept forever
+		expires = now.Add(store.ttl()).Unix()
+	}
+
+	var cookies []*http.Cookie
+	for name, values := range params {
+		if signedCookieParams[name] {
+			continue
+		}
+		for _, v := range values {
+			payload := signedCookiePayload{Value: v, ID: randomToken(12), IssuedAt: now.Unix(), Expires: expires, Once: once}
+			value, err := store.encode(name, mode, payload)
+			if err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			cookie := &http.Cookie{Name: name, Value: value, Path: "/", MaxAge: maxAge, HttpOnly: true}
+			if cookie.String() == "" {
+				RenderError(w, fmt.Sprintf("invalid cookie name %q", name), http.StatusBadRequest)
+				return
+			}
+			cookies = append(cookies, cookie)
+		}
+	}
+
+	for _, cookie := range cookies {
+		http.SetCookie(w, cookie)
+	}
+	http.Redirect(w, r, "/cookies/signed/verify", http.StatusFound)
+}
+
+// VerifySignedCookiesHandle verifies the cookies issued by `SetSignedCookiesHandle`
+// and reports whether each of them is valid, tampered, expired or replayed.
+// Cookies, which were not issued by the endpoint, are reported as unsigned.
+// It returns 401 if there are no signed cookies and 403 if any of them is not valid.
+func VerifySignedCookiesHandle(w http.ResponseWriter, r *http.Request) {
+	store := getConfig(r).SignedCookies
+
+	resp := SignedCookiesResponse{Cookies: []SignedCookieResult{}}
+	signed, valid := 0, 0
+	for _, cookie := range r.Cookies() {
+		result := store.verify(cookie)
+		if result.Status != SignedCookieUnsigned {
+			signed++
+		}
+		if result.Status == SignedCookieValid {
+			valid++
+		}
+		resp.Cookies = append(resp.Cookies, result)
+	}
+	resp.Valid = signed > 0 && signed == valid
+
+	status := http.StatusOK
+	switch {
+	case signed == 0:
+		status = http.StatusUnauthorized
+	case !resp.Valid:
+		status = http.StatusForbidden
+	}
+	RenderResponse(w, status, resp)
+}
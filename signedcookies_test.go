@@ -0,0 +1,218 @@
+package httpbulb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SignedCookiesSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	store      *SignedCookieStore
+}
+
+func (s *SignedCookiesSuite) SetupSuite() {
+	s.store = NewSignedCookieStore()
+	s.store.Key = []byte("secret")
+	s.testServer = httptest.NewServer(NewRouterWithConfig(Config{SignedCookies: s.store}))
+}
+
+func (s *SignedCookiesSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+// setCookies calls `/cookies/signed/set` without following the redirect and returns the issued cookies.
+func (s *SignedCookiesSuite) setCookies(query string) []*http.Cookie {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(s.testServer.URL + "/cookies/signed/set?" + query)
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Require().Equal(http.StatusFound, resp.StatusCode)
+	s.Require().Equal("/cookies/signed/verify", resp.Header.Get("Location"))
+	return resp.Cookies()
+}
+
+// verify sends the cookies to `/cookies/signed/verify`.
+func (s *SignedCookiesSuite) verify(cookies ...*http.Cookie) (int, *SignedCookiesResponse) {
+	req, err := http.NewRequest(http.MethodGet, s.testServer.URL+"/cookies/signed/verify", nil)
+	s.Require().NoError(err)
+	for _, c := range cookies {
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	result := &SignedCookiesResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	return resp.StatusCode, result
+}
+
+func (s *SignedCookiesSuite) TestRoundTrip() {
+	for _, mode := range []string{SignedCookieModeSigned, SignedCookieModeEncrypted} {
+		s.T().Run(mode, func(t *testing.T) {
+			jar, err := cookiejar.New(nil)
+			require.NoError(t, err)
+			client := &http.Client{Jar: jar}
+
+			resp, err := client.Get(s.testServer.URL + "/cookies/signed/set?mode=" + mode + "&session=a%20b%3Bc&max_age=60")
+			require.NoError(t, err)
+			result := &SignedCookiesResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.True(t, result.Valid)
+			require.Len(t, result.Cookies, 1)
+			cookie := result.Cookies[0]
+			require.Equal(t, "session", cookie.Name)
+			require.Equal(t, SignedCookieValid, cookie.Status)
+			require.Equal(t, mode, cookie.Mode)
+			require.Equal(t, "a b;c", cookie.Value)
+			require.NotZero(t, cookie.Expires)
+		})
+	}
+
+	// the encrypted value is not readable from the cookie
+	cookies := s.setCookies("mode=encrypted&session=visible")
+	s.Require().Len(cookies, 1)
+	s.Require().NotContains(cookies[0].Value, "visible")
+}
+
+func (s *SignedCookiesSuite) TestVerify() {
+	type testArgs struct {
+		name           string
+		cookies        func() []*http.Cookie
+		wantStatusCode int
+		wantStatus     string
+	}
+
+	tamper := func(c *http.Cookie) *http.Cookie {
+		// flip a character in the middle of the value
+		i := len(c.Value) / 2
+		b := []byte(c.Value)
+		if b[i] == 'A' {
+			b[i] = 'B'
+		} else {
+			b[i] = 'A'
+		}
+		return &http.Cookie{Name: c.Name, Value: string(b)}
+	}
+
+	tests := []testArgs{
+		{
+			name:           "tampered signed",
+			cookies:        func() []*http.Cookie { return []*http.Cookie{tamper(s.setCookies("k=v")[0])} },
+			wantStatusCode: http.StatusForbidden, wantStatus: SignedCookieTampered,
+		},
+		{
+			name:           "tampered encrypted",
+			cookies:        func() []*http.Cookie { return []*http.Cookie{tamper(s.setCookies("mode=encrypted&k=v")[0])} },
+			wantStatusCode: http.StatusForbidden, wantStatus: SignedCookieTampered,
+		},
+		{
+			name: "truncated",
+			cookies: func() []*http.Cookie {
+				c := s.setCookies("k=v")[0]
+				return []*http.Cookie{{Name: c.Name, Value: c.Value[:len(c.Value)-1]}}
+			},
+			wantStatusCode: http.StatusForbidden, wantStatus: SignedCookieTampered,
+		},
+		{
+			name: "renamed",
+			cookies: func() []*http.Cookie {
+				c := s.setCookies("k=v")[0]
+				return []*http.Cookie{{Name: "other", Value: c.Value}}
+			},
+			wantStatusCode: http.StatusForbidden, wantStatus: SignedCookieTampered,
+		},
+		{
+			name: "expired",
+			cookies: func() []*http.Cookie {
+				value, err := s.store.encode("k", SignedCookieModeSigned, signedCookiePayload{
+					Value: "v", ID: "expired", IssuedAt: time.Now().Add(-time.Hour).Unix(), Expires: time.Now().Add(-time.Minute).Unix(),
+				})
+				s.Require().NoError(err)
+				return []*http.Cookie{{Name: "k", Value: value}}
+			},
+			wantStatusCode: http.StatusForbidden, wantStatus: SignedCookieExpired,
+		},
+		{
+			name: "replayed",
+			cookies: func() []*http.Cookie {
+				cookies := s.setCookies("once=true&k=v")
+				status, result := s.verify(cookies...)
+				s.Require().Equal(http.StatusOK, status)
+				s.Require().True(result.Cookies[0].Once)
+				return cookies
+			},
+			wantStatusCode: http.StatusForbidden, wantStatus: SignedCookieReplayed,
+		},
+		{
+			name:           "unsigned",
+			cookies:        func() []*http.Cookie { return []*http.Cookie{{Name: "k", Value: "v"}} },
+			wantStatusCode: http.StatusUnauthorized, wantStatus: SignedCookieUnsigned,
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			status, result := s.verify(tt.cookies()...)
+			require.Equal(t, tt.wantStatusCode, status)
+			require.False(t, result.Valid)
+			require.Len(t, result.Cookies, 1)
+			require.Equal(t, tt.wantStatus, result.Cookies[0].Status)
+			if tt.wantStatus != SignedCookieUnsigned {
+				require.NotEmpty(t, result.Cookies[0].Error)
+			}
+		})
+	}
+}
+
+func (s *SignedCookiesSuite) TestSetErrors() {
+	for _, query := range []string{"mode=plain&k=v", "max_age=soon&k=v", "max_age=0&k=v"} {
+		resp, err := http.Get(s.testServer.URL + "/cookies/signed/set?" + query)
+		s.Require().NoError(err)
+		resp.Body.Close()
+		s.Require().Equal(http.StatusBadRequest, resp.StatusCode, query)
+		s.Require().Empty(resp.Cookies())
+	}
+
+	// a key change invalidates issued cookies
+	cookies := s.setCookies("k=v")
+	other := NewSignedCookieStore()
+	result := other.verify(cookies[0])
+	s.Require().Equal(SignedCookieTampered, result.Status)
+	s.Require().True(strings.HasPrefix(cookies[0].Value, signedCookieSigned))
+}
+
+func TestSignedCookiesSuite(t *testing.T) {
+	suite.Run(t, new(SignedCookiesSuite))
+}
+
+func TestSignedCookieStoreZeroValue(t *testing.T) {
+	for _, store := range []*SignedCookieStore{{Key: []byte("secret")}, {}} {
+		now := time.Now()
+		payload := signedCookiePayload{
+			Value: "v", ID: randomToken(12), IssuedAt: now.Unix(), Expires: now.Add(store.ttl()).Unix(), Once: true,
+		}
+		value, err := store.encode("k", SignedCookieModeSigned, payload)
+		require.NoError(t, err)
+		require.NotEmpty(t, store.Key)
+		require.Equal(t, signedCookieDefaultTTL, store.ttl())
+
+		cookie := &http.Cookie{Name: "k", Value: value}
+		require.Equal(t, SignedCookieValid, store.verify(cookie).Status)
+		require.Equal(t, SignedCookieReplayed, store.verify(cookie).Status)
+	}
+}
@@ -0,0 +1,340 @@
+package httpbulb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat      = "20060102T150405Z"
+	sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// sigV4MaxSkew is the maximum difference between the request time and the server time.
+	sigV4MaxSkew = 15 * time.Minute
+	// sigV4MaxExpires is the maximum lifetime of a presigned URL (7 days).
+	sigV4MaxExpires = 7 * 24 * time.Hour
+	// sigV4MaxBodySize is the maximum size of the body hashed for the payload hash
+	sigV4MaxBodySize = 10 << 20
+)
+
+var (
+	errSigV4Missing   = errors.New("request is not signed with AWS Signature Version 4")
+	errSigV4Malformed = errors.New("malformed AWS Signature Version 4")
+)
+
+// sigV4Request contains the signature values of the request, taken from the Authorization header
+// or from the query of a presigned URL.
+type sigV4Request struct {
+	presigned     bool
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       string
+	expires       time.Duration
+}
+
+// scope returns the credential scope: `date/region/service/aws4_request`.
+func (s *sigV4Request) scope() string {
+	return strings.Join([]string{s.date, s.region, s.service, "aws4_request"}, "/")
+}
+
+// parseSigV4 extracts the signature values from the request.
+func parseSigV4(r *http.Request) (s *sigV4Request, err error) {
+	query := r.URL.Query()
+	var credential, signedHeaders string
+	s = &sigV4Request{}
+
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, sigV4Algorithm+" ") {
+		for _, part := range strings.Split(strings.TrimPrefix(authorization, sigV4Algorithm+" "), ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch name {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				s.signature = value
+			}
+		}
+		s.amzDate = r.Header.Get("X-Amz-Date")
+		if s.amzDate == "" {
+			s.amzDate = r.Header.Get("Date")
+		}
+	} else if query.Has("X-Amz-Signature") {
+		if algorithm := query.Get("X-Amz-Algorithm"); algorithm != sigV4Algorithm {
+			return nil, fmt.Errorf("%w: unsupported algorithm %q", errSigV4Malformed, algorithm)
+		}
+		s.presigned = true
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		s.signature = query.Get("X-Amz-Signature")
+		s.amzDate = query.Get("X-Amz-Date")
+
+		expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || expires <= 0 {
+			return nil, fmt.Errorf("%w: X-Amz-Expires must be a positive number of seconds", errSigV4Malformed)
+		}
+		if s.expires = time.Duration(expires) * time.Second; s.expires > sigV4MaxExpires {
+			return nil, fmt.Errorf("%w: X-Amz-Expires must be less than a week", errSigV4Malformed)
+		}
+	} else {
+		return nil, errSigV4Missing
+	}
+
+	scope := strings.Split(credential, "/")
+	if len(scope) != 5 || scope[4] != "aws4_request" {
+		return nil, fmt.Errorf("%w: credential must be in form `access-key/date/region/service/aws4_request`",
+			errSigV4Malformed)
+	}
+	s.accessKey, s.date, s.region, s.service = scope[0], scope[1], scope[2], scope[3]
+
+	if signedHeaders == "" || s.signature == "" {
+		return nil, fmt.Errorf("%w: missing SignedHeaders or Signature", errSigV4Malformed)
+	}
+	s.signedHeaders = strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(s.signedHeaders) || !containsFold(s.signedHeaders, "host") {
+		return nil, fmt.Errorf("%w: SignedHeaders must be sorted and include host", errSigV4Malformed)
+	}
+	return s, nil
+}
+
+// checkTime checks the request time against the credential date and the current time.
+func (s *sigV4Request) checkTime(now time.Time) error {
+	t, err := time.Parse(sigV4TimeFormat, s.amzDate)
+	if err != nil {
+		return fmt.Errorf("%w: X-Amz-Date must be in %s format", errSigV4Malformed, sigV4TimeFormat)
+	}
+	if s.date != t.Format("20060102") {
+		return fmt.Errorf("credential date %s doesn't match X-Amz-Date %s", s.date, s.amzDate)
+	}
+	if s.presigned {
+		if now.Before(t.Add(-sigV4MaxSkew)) {
+			return errors.New("request is not yet valid")
+		}
+		if now.After(t.Add(s.expires)) {
+			return errors.New("request has expired")
+		}
+		return nil
+	}
+	if d := now.Sub(t); d > sigV4MaxSkew || d < -sigV4MaxSkew {
+		return errors.New("request time is too skewed")
+	}
+	return nil
+}
+
+// payloadHash returns the hash of the payload, as it is declared by the client
+// (`X-Amz-Content-Sha256` header or `UNSIGNED-PAYLOAD` for presigned URLs) or computed from the body.
+// A declared hash must match the body.
+func (s *sigV4Request) payloadHash(r *http.Request) (string, error) {
+	declared := r.Header.Get("X-Amz-Content-Sha256")
+	if s.presigned && declared == "" {
+		return sigV4UnsignedPayload, nil
+	}
+	if declared == sigV4UnsignedPayload || strings.HasPrefix(declared, "STREAMING-") {
+		return declared, nil
+	}
+
+	body, err := readBodyLimit(r.Body, sigV4MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	computed := hex.EncodeToString(sum[:])
+	if declared != "" && declared != computed {
+		return "", fmt.Errorf("X-Amz-Content-Sha256 %s doesn't match the body hash %s", declared, computed)
+	}
+	return computed, nil
+}
+
+// canonicalRequest builds the canonical request of AWS Signature Version 4.
+func (s *sigV4Request) canonicalRequest(r *http.Request, payloadHash string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+	b.WriteString(sigV4CanonicalURI(r.URL, s.service))
+	b.WriteByte('\n')
+	b.WriteString(sigV4CanonicalQuery(r.URL.Query()))
+	b.WriteByte('\n')
+	for _, name := range s.signedHeaders {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(sigV4HeaderValue(r, name))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(s.signedHeaders, ";"))
+	b.WriteByte('\n')
+	b.WriteString(payloadHash)
+	return b.String()
+}
+
+// stringToSign builds the string to sign from the canonical request.
+func (s *sigV4Request) stringToSign(canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{sigV4Algorithm, s.amzDate, s.scope(), hex.EncodeToString(sum[:])}, "\n")
+}
+
+// sign returns the hex-encoded signature of the string to sign with the derived signing key.
+func (s *sigV4Request) sign(secretKey, stringToSign string) string {
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{s.date, s.region, s.service, "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return hex.EncodeToString(key)
+}
+
+// verify computes the signature of the request and compares it with the given one.
+// It fills the response with the computed values, so mismatches can be debugged.
+func (s *sigV4Request) verify(r *http.Request, secretKey string, resp *SigV4Response) error {
+	payloadHash, err := s.payloadHash(r)
+	if err != nil {
+		return err
+	}
+	resp.CanonicalRequest = s.canonicalRequest(r, payloadHash)
+	resp.StringToSign = s.stringToSign(resp.CanonicalRequest)
+	resp.ExpectedSignature = s.sign(secretKey, resp.StringToSign)
+
+	if subtle.ConstantTimeCompare([]byte(resp.ExpectedSignature), []byte(s.signature)) != 1 {
+		return errors.New("the request signature doesn't match the computed signature")
+	}
+	return nil
+}
+
+// sigV4CanonicalURI returns the URI-encoded path.
+// S3 encodes the path once, other services encode the already encoded path again.
+func sigV4CanonicalURI(u *url.URL, service string) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if service == "s3" {
+			if unescaped, err := url.PathUnescape(segment); err == nil {
+				segment = unescaped
+			}
+		}
+		segments[i] = sigV4Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4CanonicalQuery returns the query sorted by names and values, without the signature.
+func sigV4CanonicalQuery(query url.Values) string {
+	// params are sorted as (name, value) pairs: sorting the joined `name=value` strings
+	// would put `id2=1` before `id=1`
+	type param struct{ name, value string }
+	params := make([]param, 0, len(query))
+	for name, values := range query {
+		if name == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, param{sigV4Escape(name), sigV4Escape(value)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].name != params[j].name {
+			return params[i].name < params[j].name
+		}
+		return params[i].value < params[j].value
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.name + "=" + p.value
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4HeaderValue returns the canonical value of the header:
+// multiple values are joined with commas, sequential spaces are collapsed.
+func sigV4HeaderValue(r *http.Request, name string) string {
+	var values []string
+	if name == "host" {
+		values = []string{r.Host}
+	} else {
+		values = r.Header.Values(name)
+	}
+	for i, value := range values {
+		values[i] = strings.Join(strings.Fields(value), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// sigV4Escape percent-encodes everything except unreserved characters (RFC 3986).
+func sigV4Escape(s string) string {
+	return percentEncode(s, "-_.~")
+}
+
+// AWSSigV4Handle verifies AWS Signature Version 4 of the request with the access keys from `Config.AWSKeys`.
+// The signature can be passed in the Authorization header or in the query of a presigned URL.
+// The path after `/aws-sigv4` and any query parameters are part of the signed request.
+//
+// It returns 401 if the request is not signed, 400 if the signature is malformed,
+// 403 if the access key is unknown, the request time is invalid or the signature doesn't match.
+// The response contains the canonical request and the string to sign computed by the server.
+func AWSSigV4Handle(w http.ResponseWriter, r *http.Request) {
+	cfg := getConfig(r)
+
+	sig, err := parseSigV4(r)
+	switch {
+	case errors.Is(err, errSigV4Missing):
+		RenderError(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := &SigV4Response{
+		AccessKey:       sig.accessKey,
+		Region:          sig.region,
+		Service:         sig.service,
+		Presigned:       sig.presigned,
+		SignedHeaders:   sig.signedHeaders,
+		CredentialScope: sig.scope(),
+	}
+
+	secretKey, ok := cfg.AWSKeys[sig.accessKey]
+	if !ok {
+		resp.Error = fmt.Sprintf("unknown access key %q", sig.accessKey)
+		RenderResponse(w, http.StatusForbidden, resp)
+		return
+	}
+
+	if err = sig.checkTime(time.Now()); errors.Is(err, errSigV4Malformed) {
+		RenderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		err = sig.verify(r, secretKey, resp)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		status := http.StatusForbidden
+		var bodyErr *bodyError
+		if errors.As(err, &bodyErr) {
+			status = bodyErr.status
+		}
+		RenderResponse(w, status, resp)
+		return
+	}
+
+	resp.Authenticated = true
+	RenderResponse(w, http.StatusOK, resp)
+}
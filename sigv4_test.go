@@ -0,0 +1,267 @@
+package httpbulb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	testAWSAccessKey = "AKIDEXAMPLE"
+	testAWSSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// signSigV4 signs the request with the Authorization header.
+func signSigV4(r *http.Request, body, accessKey, secretKey string, t time.Time) {
+	sig := &sigV4Request{
+		accessKey:     accessKey,
+		date:          t.UTC().Format("20060102"),
+		region:        "us-east-1",
+		service:       "service",
+		signedHeaders: []string{"host", "x-amz-content-sha256", "x-amz-date"},
+		amzDate:       t.UTC().Format(sigV4TimeFormat),
+	}
+	sum := sha256.Sum256([]byte(body))
+	payloadHash := hex.EncodeToString(sum[:])
+	r.Header.Set("X-Amz-Date", sig.amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signature := sig.sign(secretKey, sig.stringToSign(sig.canonicalRequest(r, payloadHash)))
+	r.Header.Set("Authorization", sigV4Algorithm+" Credential="+accessKey+"/"+sig.scope()+
+		", SignedHeaders="+strings.Join(sig.signedHeaders, ";")+", Signature="+signature)
+}
+
+// presignSigV4 returns the presigned URL.
+func presignSigV4(rawURL, accessKey, secretKey string, t time.Time, expires time.Duration) string {
+	u, _ := url.Parse(rawURL)
+	sig := &sigV4Request{
+		presigned:     true,
+		accessKey:     accessKey,
+		date:          t.UTC().Format("20060102"),
+		region:        "us-east-1",
+		service:       "s3",
+		signedHeaders: []string{"host"},
+		amzDate:       t.UTC().Format(sigV4TimeFormat),
+	}
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", accessKey+"/"+sig.scope())
+	query.Set("X-Amz-Date", sig.amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = query.Encode()
+
+	r, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	signature := sig.sign(secretKey, sig.stringToSign(sig.canonicalRequest(r, sigV4UnsignedPayload)))
+	return u.String() + "&X-Amz-Signature=" + signature
+}
+
+func TestSigV4Vanilla(t *testing.T) {
+	// `get-vanilla` case of the AWS Signature Version 4 test suite
+	r := httptest.NewRequest(http.MethodGet, "http://example.amazonaws.com/", nil)
+	r.Header.Set("X-Amz-Date", "20150830T123600Z")
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")
+
+	sig, err := parseSigV4(r)
+	require.NoError(t, err)
+
+	resp := &SigV4Response{}
+	require.NoError(t, sig.verify(r, testAWSSecretKey, resp))
+	require.Equal(t, "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n"+
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", resp.CanonicalRequest)
+}
+
+func TestSigV4VanillaQuery(t *testing.T) {
+	// `get-vanilla-query-order-key-case` case of the AWS Signature Version 4 test suite
+	type testArgs struct {
+		name      string
+		target    string
+		query     string
+		signature string
+	}
+
+	tests := []testArgs{
+		{
+			name:      "get-vanilla-query-order-key-case",
+			target:    "/?Param2=value2&Param1=value1",
+			query:     "Param1=value1&Param2=value2",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.amazonaws.com"+tt.target, nil)
+			r.Header.Set("X-Amz-Date", "20150830T123600Z")
+			r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders=host;x-amz-date, Signature="+tt.signature)
+
+			sig, err := parseSigV4(r)
+			require.NoError(t, err)
+
+			resp := &SigV4Response{}
+			require.NoError(t, sig.verify(r, testAWSSecretKey, resp))
+			require.Equal(t, "GET\n/\n"+tt.query+"\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n"+
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", resp.CanonicalRequest)
+		})
+	}
+}
+
+func TestSigV4CanonicalQueryPrefixKeys(t *testing.T) {
+	query := url.Values{"id2": {"1"}, "id": {"1"}, "a-b": {"1"}, "a": {"2", "1"}}
+	require.Equal(t, "a=1&a=2&a-b=1&id=1&id2=1", sigV4CanonicalQuery(query))
+}
+
+type SigV4Suite struct {
+	suite.Suite
+	testServer *httptest.Server
+	client     *http.Client
+}
+
+func (s *SigV4Suite) SetupSuite() {
+	cfg := Config{AWSKeys: map[string]string{testAWSAccessKey: testAWSSecretKey}}
+	s.testServer = httptest.NewServer(NewRouterWithConfig(cfg))
+	s.client = http.DefaultClient
+}
+
+func (s *SigV4Suite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func (s *SigV4Suite) TestSignedHeaders() {
+	type testArgs struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		sendBody       string
+		accessKey      string
+		secretKey      string
+		time           time.Time
+		authorization  string
+		wantStatusCode int
+		wantError      string
+	}
+
+	now := time.Now()
+
+	tests := []testArgs{
+		{name: "GET", method: http.MethodGet, path: "/aws-sigv4",
+			wantStatusCode: http.StatusOK},
+		{name: "GET with path and query", method: http.MethodGet, path: "/aws-sigv4/a%20b/c?z=1&a=2&a=1&space=x%20y",
+			wantStatusCode: http.StatusOK},
+		{name: "POST with body", method: http.MethodPost, path: "/aws-sigv4", body: `{"hello":"world"}`,
+			wantStatusCode: http.StatusOK},
+		{name: "wrong secret", method: http.MethodGet, path: "/aws-sigv4", secretKey: "wrong",
+			wantStatusCode: http.StatusForbidden, wantError: "doesn't match"},
+		{name: "unknown access key", method: http.MethodGet, path: "/aws-sigv4", accessKey: "AKIDUNKNOWN",
+			wantStatusCode: http.StatusForbidden, wantError: "unknown access key"},
+		{name: "modified body", method: http.MethodPost, path: "/aws-sigv4", body: `{"hello":"world"}`,
+			sendBody: `{"hello":"moon"}`, wantStatusCode: http.StatusForbidden, wantError: "X-Amz-Content-Sha256"},
+		{name: "too large body", method: http.MethodPost, path: "/aws-sigv4", body: strings.Repeat("a", sigV4MaxBodySize+1),
+			wantStatusCode: http.StatusRequestEntityTooLarge, wantError: "can't be verified"},
+		{name: "skewed time", method: http.MethodGet, path: "/aws-sigv4", time: now.Add(-time.Hour),
+			wantStatusCode: http.StatusForbidden, wantError: "skewed"},
+		{name: "not signed", method: http.MethodGet, path: "/aws-sigv4", authorization: "Basic dXNlcjpwYXNzd2Q=",
+			wantStatusCode: http.StatusUnauthorized},
+		{name: "malformed credential", method: http.MethodGet, path: "/aws-sigv4",
+			authorization:  "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE, SignedHeaders=host, Signature=abc",
+			wantStatusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			sendBody := tt.sendBody
+			if sendBody == "" {
+				sendBody = tt.body
+			}
+			req, err := http.NewRequest(tt.method, s.testServer.URL+tt.path, strings.NewReader(sendBody))
+			require.NoError(t, err)
+
+			accessKey, secretKey, signTime := tt.accessKey, tt.secretKey, tt.time
+			if accessKey == "" {
+				accessKey = testAWSAccessKey
+			}
+			if secretKey == "" {
+				secretKey = testAWSSecretKey
+			}
+			if signTime.IsZero() {
+				signTime = now
+			}
+			signSigV4(req, tt.body, accessKey, secretKey, signTime)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			resp, err := s.client.Do(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode, string(body))
+
+			result := &SigV4Response{}
+			require.NoError(t, json.Unmarshal(body, result))
+			require.Equal(t, tt.wantStatusCode == http.StatusOK, result.Authenticated)
+			if tt.wantError != "" {
+				require.Contains(t, result.Error, tt.wantError)
+			}
+			if tt.name == "wrong secret" {
+				// the computed values help to debug the mismatch
+				require.True(t, strings.HasPrefix(result.CanonicalRequest, "GET\n/aws-sigv4\n"))
+				require.True(t, strings.HasPrefix(result.StringToSign, sigV4Algorithm+"\n"))
+				require.NotEmpty(t, result.ExpectedSignature)
+			}
+		})
+	}
+}
+
+func (s *SigV4Suite) TestPresignedURL() {
+	type testArgs struct {
+		name           string
+		url            string
+		wantStatusCode int
+	}
+
+	now := time.Now()
+	base := s.testServer.URL + "/aws-sigv4/bucket/key.txt?versionId=1"
+
+	tests := []testArgs{
+		{name: "valid", url: presignSigV4(base, testAWSAccessKey, testAWSSecretKey, now, time.Minute),
+			wantStatusCode: http.StatusOK},
+		{name: "expired", url: presignSigV4(base, testAWSAccessKey, testAWSSecretKey, now.Add(-time.Hour), time.Minute),
+			wantStatusCode: http.StatusForbidden},
+		{name: "wrong secret", url: presignSigV4(base, testAWSAccessKey, "wrong", now, time.Minute),
+			wantStatusCode: http.StatusForbidden},
+		{name: "modified query", url: presignSigV4(base, testAWSAccessKey, testAWSSecretKey, now, time.Minute) + "&x=1",
+			wantStatusCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			resp, err := s.client.Get(tt.url)
+			require.NoError(t, err)
+			result := &SigV4Response{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatusCode, resp.StatusCode, result.Error)
+			require.True(t, result.Presigned)
+		})
+	}
+}
+
+func TestSigV4Suite(t *testing.T) {
+	suite.Run(t, new(SigV4Suite))
+}
@@ -0,0 +1,293 @@
+package httpbulb
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errStructuredField is returned when a structured field (RFC 8941) is malformed.
+var errStructuredField = errors.New("malformed structured field")
+
+// sfToken is a token value of a structured field, it is serialized without quotes.
+type sfToken string
+
+// sfItem is an item or an inner list of a structured field with its parameters.
+// value is one of: string, sfToken, int64, []byte, bool or []sfItem (an inner list).
+type sfItem struct {
+	value  interface{}
+	params []sfParam
+}
+
+// param returns the value of the parameter and true if the parameter is present.
+func (it sfItem) param(name string) (interface{}, bool) {
+	for _, p := range it.params {
+		if p.name == name {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+type sfParam struct {
+	name  string
+	value interface{}
+}
+
+// sfMember is a member of a structured field dictionary.
+type sfMember struct {
+	name string
+	item sfItem
+}
+
+// parseSFDictionary parses a structured field dictionary (RFC 8941, section 4.2.2), the members keep their order.
+// Decimals are not supported.
+func parseSFDictionary(s string) (members []sfMember, err error) {
+	p := &sfParser{s: s}
+	p.skipSP()
+	for !p.done() {
+		var m sfMember
+		if m.name, err = p.key(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '=' {
+			p.i++
+			if m.item, err = p.itemOrInnerList(); err != nil {
+				return nil, err
+			}
+		} else {
+			m.item.value = true
+			if m.item.params, err = p.parameters(); err != nil {
+				return nil, err
+			}
+		}
+
+		// a duplicate key overrides the value, but keeps the position
+		replaced := false
+		for i := range members {
+			if members[i].name == m.name {
+				members[i].item = m.item
+				replaced = true
+			}
+		}
+		if !replaced {
+			members = append(members, m)
+		}
+
+		p.skipOWS()
+		if p.done() {
+			return
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf("expected ','")
+		}
+		p.i++
+		p.skipOWS()
+		if p.done() {
+			return nil, p.errorf("trailing ','")
+		}
+	}
+	return
+}
+
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) done() bool { return p.i >= len(p.s) }
+
+func (p *sfParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) skipSP() {
+	for p.peek() == ' ' {
+		p.i++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.i++
+	}
+}
+
+func (p *sfParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at position %d", errStructuredField, fmt.Sprintf(format, args...), p.i)
+}
+
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	if c := p.peek(); !(('a' <= c && c <= 'z') || c == '*') {
+		return "", p.errorf("expected key")
+	}
+	for !p.done() {
+		c := p.peek()
+		if !(('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("_-.*", c) >= 0) {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *sfParser) itemOrInnerList() (it sfItem, err error) {
+	if p.peek() != '(' {
+		if it.value, err = p.bareItem(); err != nil {
+			return
+		}
+		it.params, err = p.parameters()
+		return
+	}
+
+	p.i++
+	items := []sfItem{}
+	for {
+		p.skipSP()
+		if p.done() {
+			return it, p.errorf("unterminated inner list")
+		}
+		if p.peek() == ')' {
+			p.i++
+			break
+		}
+		var item sfItem
+		if item.value, err = p.bareItem(); err != nil {
+			return
+		}
+		if item.params, err = p.parameters(); err != nil {
+			return
+		}
+		items = append(items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return it, p.errorf("expected ' ' or ')'")
+		}
+	}
+	it.value = items
+	it.params, err = p.parameters()
+	return
+}
+
+func (p *sfParser) parameters() (params []sfParam, err error) {
+	for p.peek() == ';' {
+		p.i++
+		p.skipSP()
+		var param sfParam
+		if param.name, err = p.key(); err != nil {
+			return nil, err
+		}
+		param.value = true
+		if p.peek() == '=' {
+			p.i++
+			if param.value, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params = append(params, param)
+	}
+	return
+}
+
+func (p *sfParser) bareItem() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == '-' || ('0' <= c && c <= '9'):
+		start := p.i
+		p.i++
+		for '0' <= p.peek() && p.peek() <= '9' {
+			p.i++
+		}
+		if p.peek() == '.' {
+			return nil, p.errorf("decimals are not supported")
+		}
+		n, err := strconv.ParseInt(p.s[start:p.i], 10, 64)
+		if err != nil || p.i-start > 16 {
+			return nil, p.errorf("invalid integer")
+		}
+		return n, nil
+	case c == '"':
+		value, next, err := readQuotedString(p.s, p.i)
+		if err != nil {
+			return nil, p.errorf("unterminated string")
+		}
+		p.i = next
+		return value, nil
+	case c == ':':
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+		if end < 0 {
+			return nil, p.errorf("unterminated byte sequence")
+		}
+		data, err := base64.StdEncoding.DecodeString(p.s[p.i+1 : p.i+1+end])
+		if err != nil {
+			return nil, p.errorf("invalid byte sequence")
+		}
+		p.i += end + 2
+		return data, nil
+	case c == '?':
+		p.i++
+		switch p.peek() {
+		case '0', '1':
+			p.i++
+			return p.s[p.i-1] == '1', nil
+		}
+		return nil, p.errorf("invalid boolean")
+	case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '*':
+		start := p.i
+		for !p.done() && (isTokenChar(p.peek()) || p.peek() == ':' || p.peek() == '/') {
+			p.i++
+		}
+		return sfToken(p.s[start:p.i]), nil
+	}
+	return nil, p.errorf("unexpected character %q", c)
+}
+
+// serializeSFItem serializes an item or an inner list with its parameters.
+func serializeSFItem(it sfItem) string {
+	var b strings.Builder
+	if items, ok := it.value.([]sfItem); ok {
+		b.WriteByte('(')
+		for i, item := range items {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(serializeSFItem(item))
+		}
+		b.WriteByte(')')
+	} else {
+		b.WriteString(serializeSFBareItem(it.value))
+	}
+	for _, p := range it.params {
+		b.WriteByte(';')
+		b.WriteString(p.name)
+		if v, ok := p.value.(bool); !ok || !v {
+			b.WriteByte('=')
+			b.WriteString(serializeSFBareItem(p.value))
+		}
+	}
+	return b.String()
+}
+
+func serializeSFBareItem(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return quoteAuthParam(v)
+	case sfToken:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(v) + ":"
+	case bool:
+		if v {
+			return "?1"
+		}
+		return "?0"
+	}
+	return ""
+}
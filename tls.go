@@ -0,0 +1,123 @@
+package httpbulb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Client certificate modes for `ClientAuthType`.
+const (
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+	ClientAuthVerify  = "verify"
+)
+
+// ClientAuthType converts the client certificate mode to `tls.ClientAuthType`:
+//   - `request` asks for a certificate, but doesn't require it;
+//   - `require` requires any certificate, it is not verified during the handshake;
+//   - `verify` requires a certificate signed by the client CA.
+//
+// An empty mode is treated as `request`.
+func ClientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(mode) {
+	case "", ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthRequire:
+		return tls.RequireAnyClientCert, nil
+	case ClientAuthVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", mode)
+}
+
+func newCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	info := CertificateInfo{
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		SerialNumber:   fmt.Sprintf("%X", cert.SerialNumber),
+		NotBefore:      cert.NotBefore.UTC(),
+		NotAfter:       cert.NotAfter.UTC(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IsCA:           cert.IsCA,
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	return info
+}
+
+// verifyClientCert verifies the presented chain with the client CA pool.
+func verifyClientCert(state *tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.VerifiedChains) > 0 {
+		// the chain was already verified during the handshake
+		return nil
+	}
+	if roots == nil {
+		return errors.New("client CA is not configured")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
+// TLSHandle returns the details of the negotiated TLS connection: version, cipher suite,
+// ALPN protocol, SNI server name, session resumption and ECH state (if it is supported by the Go version).
+// crypto/tls doesn't accept 0-RTT data, so early data is never reported.
+func TLSHandle(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil {
+		RenderError(w, "the request was not made over TLS", http.StatusBadRequest)
+		return
+	}
+
+	RenderResponse(w, http.StatusOK, &TLSResponse{
+		Version:            tls.VersionName(r.TLS.Version),
+		CipherSuite:        tls.CipherSuiteName(r.TLS.CipherSuite),
+		NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+		ServerName:         r.TLS.ServerName,
+		DidResume:          r.TLS.DidResume,
+		ECHAccepted:        echAccepted(r.TLS),
+		ClientCertificates: len(r.TLS.PeerCertificates),
+	})
+}
+
+// TLSClientCertHandle returns the client certificate chain presented during the TLS handshake
+// and the result of its verification with `Config.ClientCAs`.
+// The server must request client certificates (`tls.Config.ClientAuth`), otherwise the chain is always empty.
+func TLSClientCertHandle(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil {
+		RenderError(w, "the request was not made over TLS", http.StatusBadRequest)
+		return
+	}
+
+	resp := &ClientCertResponse{Chain: []CertificateInfo{}}
+	for _, cert := range r.TLS.PeerCertificates {
+		resp.Chain = append(resp.Chain, newCertificateInfo(cert))
+	}
+
+	if len(r.TLS.PeerCertificates) > 0 {
+		resp.Presented = true
+		if err := verifyClientCert(r.TLS, getConfig(r).ClientCAs); err != nil {
+			resp.VerifyError = err.Error()
+		} else {
+			resp.Verified = true
+		}
+	}
+
+	RenderResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,217 @@
+package httpbulb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func (c testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// newTestCert creates a certificate signed by the parent, or a self-signed CA if parent is nil.
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	} else {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCert{cert: cert, key: key}
+}
+
+type TLSSuite struct {
+	suite.Suite
+	testServer *httptest.Server
+	ca         testCert
+}
+
+func (s *TLSSuite) SetupSuite() {
+	s.ca = newTestCert(s.T(), &x509.Certificate{Subject: pkix.Name{CommonName: "Bulb Client CA"}}, nil)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(s.ca.cert)
+
+	s.testServer = httptest.NewUnstartedServer(NewRouterWithConfig(Config{ClientCAs: pool}))
+	s.testServer.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	s.testServer.StartTLS()
+}
+
+func (s *TLSSuite) TearDownSuite() {
+	s.testServer.Close()
+}
+
+func (s *TLSSuite) clientCert(cert testCert) *http.Client {
+	client := s.testServer.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert.tlsCertificate()}
+	return &http.Client{Transport: transport}
+}
+
+func (s *TLSSuite) TestClientCert() {
+	valid := newTestCert(s.T(), &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "client", Organization: []string{"Bulb"}},
+		DNSNames:       []string{"client.example"},
+		EmailAddresses: []string{"client@example.com"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &s.ca)
+
+	untrustedCA := newTestCert(s.T(), &x509.Certificate{Subject: pkix.Name{CommonName: "Untrusted CA"}}, nil)
+	untrusted := newTestCert(s.T(), &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "untrusted"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &untrustedCA)
+
+	type testArgs struct {
+		name          string
+		client        *http.Client
+		wantPresented bool
+		wantVerified  bool
+		wantSubject   string
+	}
+
+	tests := []testArgs{
+		{name: "no certificate", client: s.testServer.Client()},
+		{
+			name:          "valid certificate",
+			client:        s.clientCert(valid),
+			wantPresented: true,
+			wantVerified:  true,
+			wantSubject:   "CN=client,O=Bulb",
+		},
+		{
+			name:          "untrusted certificate",
+			client:        s.clientCert(untrusted),
+			wantPresented: true,
+			wantSubject:   "CN=untrusted",
+		},
+	}
+
+	for _, tt := range tests {
+		s.T().Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(s.testServer.URL + "/tls/client-cert")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			result := new(ClientCertResponse)
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+			require.Equal(t, tt.wantPresented, result.Presented)
+			require.Equal(t, tt.wantVerified, result.Verified)
+
+			if !tt.wantPresented {
+				require.Empty(t, result.Chain)
+				return
+			}
+			require.Len(t, result.Chain, 1)
+			require.Equal(t, tt.wantSubject, result.Chain[0].Subject)
+			if tt.wantVerified {
+				require.Empty(t, result.VerifyError)
+				require.Equal(t, []string{"client.example"}, result.Chain[0].DNSNames)
+				require.Equal(t, []string{"client@example.com"}, result.Chain[0].EmailAddresses)
+				require.Equal(t, "CN=Bulb Client CA", result.Chain[0].Issuer)
+			} else {
+				require.NotEmpty(t, result.VerifyError)
+			}
+		})
+	}
+}
+
+func (s *TLSSuite) TestWithoutTLS() {
+	testServer := httptest.NewServer(NewRouter())
+	defer testServer.Close()
+
+	for _, path := range []string{"/tls", "/tls/client-cert"} {
+		resp, err := http.Get(testServer.URL + path)
+		s.Require().NoError(err)
+		resp.Body.Close()
+		s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func (s *TLSSuite) TestConnectionState() {
+	transport := s.testServer.Client().Transport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.TLSClientConfig.ServerName = "example.com"
+	transport.TLSClientConfig.MinVersion = tls.VersionTLS13
+	transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	client := &http.Client{Transport: transport}
+
+	get := func() *TLSResponse {
+		resp, err := client.Get(s.testServer.URL + "/tls")
+		s.Require().NoError(err)
+		defer resp.Body.Close()
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+		result := new(TLSResponse)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+		return result
+	}
+
+	result := get()
+	s.Require().Equal("TLS 1.3", result.Version)
+	s.Require().NotEmpty(result.CipherSuite)
+	s.Require().Equal("example.com", result.ServerName)
+	s.Require().False(result.DidResume)
+	s.Require().Zero(result.ClientCertificates)
+
+	// a new connection resumes the session with the cached ticket
+	s.Require().True(get().DidResume)
+}
+
+func TestTLSSuite(t *testing.T) {
+	suite.Run(t, new(TLSSuite))
+}
+
+func TestClientAuthType(t *testing.T) {
+	tests := map[string]tls.ClientAuthType{
+		"":        tls.RequestClientCert,
+		"request": tls.RequestClientCert,
+		"require": tls.RequireAnyClientCert,
+		"Verify":  tls.RequireAndVerifyClientCert,
+	}
+	for mode, want := range tests {
+		got, err := ClientAuthType(mode)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+
+	_, err := ClientAuthType("unknown")
+	require.Error(t, err)
+}
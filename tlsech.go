@@ -0,0 +1,11 @@
+//go:build go1.23
+
+package httpbulb
+
+import "crypto/tls"
+
+// echAccepted returns whether Encrypted Client Hello was accepted.
+func echAccepted(state *tls.ConnectionState) *bool {
+	accepted := state.ECHAccepted
+	return &accepted
+}
@@ -0,0 +1,10 @@
+//go:build !go1.23
+
+package httpbulb
+
+import "crypto/tls"
+
+// echAccepted returns nil: ECH is supported since Go 1.23.
+func echAccepted(state *tls.ConnectionState) *bool {
+	return nil
+}